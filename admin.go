@@ -0,0 +1,511 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+)
+
+const (
+	adminTimeout   = 2 * time.Second // how long to wait for a room to respond
+	maxParamsBytes = 4096
+)
+
+const (
+	AdminKick      = "kick"
+	AdminSetTeam   = "team"
+	AdminRestart   = "restart"
+	AdminChangeMap = "map"
+	AdminAddBot    = "addbot"
+	AdminRemoveBot = "removebot"
+	AdminSetParams = "params"
+	AdminSetPreset = "preset"
+)
+
+// Change to a game requested through the admin API, recorded in replays so that they play out the same
+type AdminAction struct {
+	Kind     string
+	PlayerId uint8
+	Team     int
+	Map      string
+	Params   json.RawMessage `json:",omitempty"` // shared params to change, or the changes the preset makes
+	Preset   string
+}
+
+type AdminPlayer struct {
+	Id        uint8
+	Name      string
+	Team      int
+	State     string
+	Address   string
+	Bot       bool
+	Spectator bool
+}
+
+type AdminRoom struct {
+	Room       string
+	Mode       string
+	Map        string
+	Players    []AdminPlayer
+	Params     conf.SharedParams
+	Preset     string
+	NextPreset string // preset the next match will be played with, empty if it won't change
+
+	paramsHistory []ParamsChange
+}
+
+type AdminParams struct {
+	Room    string
+	Params  conf.SharedParams
+	History []ParamsChange
+}
+
+// Handled by the game between ticks. Rooms are described when there is no action.
+type adminRequest struct {
+	action *AdminAction
+	replyC chan adminReply
+}
+
+type adminReply struct {
+	room AdminRoom
+	err  error
+}
+
+// Addresses that can't connect, safe for concurrent use
+type BanList struct {
+	mutex sync.Mutex
+	addrs map[string]bool
+}
+
+func NewBanList() *BanList {
+	return &BanList{addrs: map[string]bool{}}
+}
+
+func (b *BanList) Add(addr string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.addrs[addr] = true
+}
+
+// Returns false if the address wasn't banned
+func (b *BanList) Remove(addr string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.addrs[addr] {
+		return false
+	}
+	delete(b.addrs, addr)
+	return true
+}
+
+func (b *BanList) Contains(addr string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.addrs[addr]
+}
+
+func (b *BanList) List() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	addrs := []string{}
+	for addr := range b.addrs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// HTTP API for managing a running server, on its own listener so that it needn't be exposed publicly. Requests must
+// carry the token as a bearer token.
+type AdminServer struct {
+	addr  string
+	token string
+	rooms *RoomManager
+}
+
+func NewAdminServer(addr string, token string, rooms *RoomManager) AdminServer {
+	if token == "" {
+		logger.Panic("admin API requires a token")
+	}
+	return AdminServer{
+		addr:  addr,
+		token: token,
+		rooms: rooms,
+	}
+}
+
+func (s *AdminServer) Run() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rooms", s.handle(http.MethodGet, s.handleRooms))
+	mux.HandleFunc("/bans", s.handle(http.MethodGet, s.handleBans))
+	mux.HandleFunc("/kick", s.handle(http.MethodPost, s.handleKick))
+	mux.HandleFunc("/ban", s.handle(http.MethodPost, s.handleBan))
+	mux.HandleFunc("/unban", s.handle(http.MethodPost, s.handleUnban))
+	mux.HandleFunc("/team", s.handle(http.MethodPost, s.handleTeam))
+	mux.HandleFunc("/restart", s.handle(http.MethodPost, s.handleRestart))
+	mux.HandleFunc("/map", s.handle(http.MethodPost, s.handleMap))
+	mux.HandleFunc("/bots/add", s.handle(http.MethodPost, s.handleAddBot))
+	mux.HandleFunc("/bots/remove", s.handle(http.MethodPost, s.handleRemoveBot))
+	mux.HandleFunc("/params", s.handle(http.MethodGet, s.handleParams))
+	mux.HandleFunc("/params/set", s.handle(http.MethodPost, s.handleSetParams))
+	mux.HandleFunc("/presets", s.handle(http.MethodGet, s.handlePresets))
+	mux.HandleFunc("/preset", s.handle(http.MethodPost, s.handlePreset))
+	logger.Info("admin API listening on ", s.addr)
+	return http.ListenAndServe(s.addr, mux)
+}
+
+// Checks the method and token, then writes the handler's result as JSON
+func (s *AdminServer) handle(method string, handler func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		want := "Bearer " + s.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			logger.Infof("admin: unauthorised request from %s to %s", r.RemoteAddr, r.URL.Path)
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		result, err := handler(r)
+		if err != nil {
+			logger.Infof("admin: %s %s from %s failed: %v", r.Method, r.URL, r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodGet {
+			logger.Infof("admin: %s %s from %s", r.Method, r.URL, r.RemoteAddr)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			logger.Error("admin: writing response: ", err)
+		}
+	}
+}
+
+func (s *AdminServer) handleRooms(r *http.Request) (interface{}, error) {
+	rooms := []AdminRoom{}
+	for _, game := range s.rooms.Rooms() {
+		room, err := askGame(game, nil)
+		if err != nil {
+			continue // closed while we were asking
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+func (s *AdminServer) handleBans(r *http.Request) (interface{}, error) {
+	return s.rooms.bans.List(), nil
+}
+
+func (s *AdminServer) handleKick(r *http.Request) (interface{}, error) {
+	return s.act(r, AdminAction{Kind: AdminKick})
+}
+
+// Bans the address of a player, everyone connected from that address is kicked
+func (s *AdminServer) handleBan(r *http.Request) (interface{}, error) {
+	game, id, err := s.findPlayer(r)
+	if err != nil {
+		return nil, err
+	}
+	room, err := askGame(game, nil)
+	if err != nil {
+		return nil, err
+	}
+	addr := ""
+	for _, player := range room.Players {
+		if player.Id == id {
+			addr = player.Address
+		}
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("player %d has no address", id)
+	}
+
+	s.rooms.bans.Add(addr)
+	logger.Infof("admin: banned %s", addr)
+	for _, game := range s.rooms.Rooms() {
+		room, err := askGame(game, nil)
+		if err != nil {
+			continue
+		}
+		for _, player := range room.Players {
+			if player.Address == addr {
+				askGame(game, &AdminAction{Kind: AdminKick, PlayerId: player.Id})
+			}
+		}
+	}
+	return addr, nil
+}
+
+func (s *AdminServer) handleUnban(r *http.Request) (interface{}, error) {
+	addr := r.FormValue("addr")
+	if !s.rooms.bans.Remove(addr) {
+		return nil, fmt.Errorf("%s is not banned", addr)
+	}
+	return addr, nil
+}
+
+func (s *AdminServer) handleTeam(r *http.Request) (interface{}, error) {
+	team, err := strconv.Atoi(r.FormValue("team"))
+	if err != nil {
+		return nil, errors.New("bad team")
+	}
+	return s.act(r, AdminAction{Kind: AdminSetTeam, Team: team})
+}
+
+func (s *AdminServer) handleRestart(r *http.Request) (interface{}, error) {
+	return s.actOnRoom(r, AdminAction{Kind: AdminRestart})
+}
+
+func (s *AdminServer) handleMap(r *http.Request) (interface{}, error) {
+	return s.actOnRoom(r, AdminAction{Kind: AdminChangeMap, Map: r.FormValue("name")})
+}
+
+func (s *AdminServer) handleAddBot(r *http.Request) (interface{}, error) {
+	return s.actOnRoom(r, AdminAction{Kind: AdminAddBot})
+}
+
+func (s *AdminServer) handleRemoveBot(r *http.Request) (interface{}, error) {
+	return s.actOnRoom(r, AdminAction{Kind: AdminRemoveBot})
+}
+
+// Current shared params of a room and the history of changes made to them
+func (s *AdminServer) handleParams(r *http.Request) (interface{}, error) {
+	game, err := s.findRoom(r)
+	if err != nil {
+		return nil, err
+	}
+	room, err := askGame(game, nil)
+	if err != nil {
+		return nil, err
+	}
+	return AdminParams{Room: room.Room, Params: room.Params, History: room.paramsHistory}, nil
+}
+
+// Changes the shared params given by the JSON object in the request body
+func (s *AdminServer) handleSetParams(r *http.Request) (interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxParamsBytes))
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("body must be a JSON object of params")
+	}
+	return s.actOnRoom(r, AdminAction{Kind: AdminSetParams, Params: body})
+}
+
+func (s *AdminServer) handlePresets(r *http.Request) (interface{}, error) {
+	presets := []conf.Preset{}
+	for _, preset := range s.rooms.presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets, nil
+}
+
+// Switches the room to the preset given by the name parameter once the current match is over
+func (s *AdminServer) handlePreset(r *http.Request) (interface{}, error) {
+	preset, ok := s.rooms.presets[r.FormValue("name")]
+	if !ok {
+		return nil, fmt.Errorf("no preset '%s'", r.FormValue("name"))
+	}
+	return s.actOnRoom(r, AdminAction{Kind: AdminSetPreset, Preset: preset.Name, Params: preset.Changes})
+}
+
+// Takes an action on the player given by the room and id parameters
+func (s *AdminServer) act(r *http.Request, action AdminAction) (interface{}, error) {
+	game, id, err := s.findPlayer(r)
+	if err != nil {
+		return nil, err
+	}
+	action.PlayerId = id
+	return askGame(game, &action)
+}
+
+// Takes an action on the room given by the room parameter
+func (s *AdminServer) actOnRoom(r *http.Request, action AdminAction) (interface{}, error) {
+	game, err := s.findRoom(r)
+	if err != nil {
+		return nil, err
+	}
+	return askGame(game, &action)
+}
+
+func (s *AdminServer) findRoom(r *http.Request) (*Game, error) {
+	name := r.FormValue("room")
+	if name == "" {
+		name = defaultRoom
+	}
+	for _, game := range s.rooms.Rooms() {
+		if game.Room == name {
+			return game, nil
+		}
+	}
+	return nil, fmt.Errorf("no room '%s'", name)
+}
+
+func (s *AdminServer) findPlayer(r *http.Request) (*Game, uint8, error) {
+	game, err := s.findRoom(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 8)
+	if err != nil {
+		return nil, 0, errors.New("bad player id")
+	}
+	return game, uint8(id), nil
+}
+
+// Has the game take the action, or describe itself if the action is nil, then returns the state of the room
+func askGame(game *Game, action *AdminAction) (AdminRoom, error) {
+	request := adminRequest{
+		action: action,
+		replyC: make(chan adminReply, 1),
+	}
+	select {
+	case game.AdminC <- request:
+	case <-time.After(adminTimeout):
+		return AdminRoom{}, fmt.Errorf("room '%s' is not responding", game.Room)
+	}
+	select {
+	case reply := <-request.replyC:
+		return reply.room, reply.err
+	case <-time.After(adminTimeout):
+		return AdminRoom{}, fmt.Errorf("room '%s' is not responding", game.Room)
+	}
+}
+
+// Handles requests from the admin API, should be called between ticks
+func (g *Game) serveAdmin() {
+	for {
+		select {
+		case request := <-g.AdminC:
+			var err error
+			if request.action != nil {
+				err = g.applyAdmin(*request.action)
+				if err == nil && g.recorder != nil {
+					actionBytes, _ := json.Marshal(request.action)
+					g.recorder.Admin(g.ticks, actionBytes)
+				}
+			}
+			request.replyC <- adminReply{room: g.describe(), err: err}
+		default:
+			return
+		}
+	}
+}
+
+func (g *Game) applyAdmin(action AdminAction) error {
+	switch action.Kind {
+	case AdminKick:
+		player := g.World.FindPlayer(action.PlayerId)
+		if player == nil {
+			return fmt.Errorf("no player %d", action.PlayerId)
+		}
+		if player.IsBot {
+			return errors.New("bots can't be kicked, remove them instead")
+		}
+		player.DoDisconnect = true
+		logger.Infof("room '%s': kicked '%s'", g.Room, player.Client.Username)
+	case AdminSetTeam:
+		player := g.World.FindPlayer(action.PlayerId)
+		if player == nil {
+			return fmt.Errorf("no player %d", action.PlayerId)
+		}
+		if g.Mode.FreeForAll() || player.Spectator {
+			return errors.New("player has no team")
+		}
+		if !g.World.Map.HasTeam(action.Team) {
+			return fmt.Errorf("map has no team %d", action.Team)
+		}
+		player.Team = action.Team
+		if player.State != entity.PlayerStateSpectating {
+			entity.SendToJail(&g.World, player) // any flag they carry is dropped
+		}
+		g.World.ScoreboardChanged = true
+		logger.Infof("room '%s': moved '%s' to team %d", g.Room, player.Client.Username, action.Team)
+	case AdminRestart:
+		g.restartRound()
+		logger.Infof("room '%s': round restarted", g.Room)
+	case AdminChangeMap:
+		index := findMap(g.maps, action.Map)
+		if index == -1 {
+			return fmt.Errorf("no map '%s'", action.Map)
+		}
+		g.rotation.Skip(g.maps[index])
+		g.voteMaps = nil
+		g.changeMap(g.maps[index])
+		g.resetMatch()
+	case AdminAddBot:
+		if !g.AddBot() {
+			return errors.New("room is full")
+		}
+	case AdminRemoveBot:
+		if !g.RemoveBot() {
+			return errors.New("there are no bots")
+		}
+	case AdminSetParams:
+		return g.tuneParams(action.Params)
+	case AdminSetPreset:
+		preset := conf.Preset{Name: action.Preset, Changes: action.Params}
+		if _, err := preset.Apply(conf.Shared); err != nil {
+			return err
+		}
+		g.nextPreset = &preset
+		logger.Infof("room '%s': next match will use preset '%s'", g.Room, preset.Name)
+	default:
+		return fmt.Errorf("unknown action '%s'", action.Kind)
+	}
+	return nil
+}
+
+func (g *Game) describe() AdminRoom {
+	room := AdminRoom{
+		Room:    g.Room,
+		Mode:    g.Mode.Name(),
+		Map:     g.World.Map.Name,
+		Players: []AdminPlayer{},
+		Params:  g.World.Params,
+		Preset:  g.preset.Name,
+
+		paramsHistory: append([]ParamsChange(nil), g.paramsHistory...), // the game may append to its own while we read
+	}
+	if g.nextPreset != nil {
+		room.NextPreset = g.nextPreset.Name
+	}
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		room.Players = append(room.Players, AdminPlayer{
+			Id:        player.Id,
+			Name:      player.Name,
+			Team:      player.Team,
+			State:     playerStateNames[player.State],
+			Address:   player.Client.Addr,
+			Bot:       player.IsBot,
+			Spectator: player.Spectator,
+		})
+	}
+	return room
+}
+
+var playerStateNames = map[int]string{
+	entity.PlayerStateSpectating: "spectating",
+	entity.PlayerStateJailed:     "jailed",
+	entity.PlayerStateAlive:      "alive",
+}
@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"math"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/mymath"
+)
+
+const (
+	sightRange     = 600.0 // furthest distance an enemy can be seen from
+	reactionTicks  = 10    // delay before shooting at an enemy that has just been seen
+	aimJitter      = 0.08  // radians, so bots aren't perfect shots
+	bouncyChance   = 0.02  // chance each tick of firing a bouncy laser when able
+	stuckCheckTick = 15    // ticks between checking if we are stuck
+	wanderTicks    = 30    // ticks to move in a random direction once stuck
+)
+
+// Per bot state that isn't part of the player
+type Bot struct {
+	PlayerId    uint8
+	targetId    int // enemy being shot at, -1 if none
+	seenTicks   int // ticks the target has been visible for
+	lastPos     mymath.Vec
+	stuckTicks  int
+	wanderDir   mymath.Vec
+	wanderTicks int
+}
+
+func newBot(id uint8) *Bot {
+	return &Bot{
+		PlayerId: id,
+		targetId: -1,
+	}
+}
+
+// Generates this tick's input for the bot's player
+func (b *Bot) think(world *entity.World, player *entity.Player) entity.PlayerInput {
+	var input entity.PlayerInput
+	input.Tick = world.Tick
+
+	if player.State != entity.PlayerStateAlive {
+		b.targetId = -1
+		b.seenTicks = 0
+		return input
+	}
+
+	b.aim(world, player, &input)
+	b.move(world, player, &input)
+	return input
+}
+
+// Shoots at the closest visible enemy
+func (b *Bot) aim(world *entity.World, player *entity.Player, input *entity.PlayerInput) {
+	enemy := closestVisibleEnemy(world, player)
+	if enemy == nil {
+		b.targetId = -1
+		b.seenTicks = 0
+		return
+	}
+	if int(enemy.Id) != b.targetId {
+		b.targetId = int(enemy.Id)
+		b.seenTicks = 0
+	}
+	b.seenTicks++
+	if b.seenTicks < reactionTicks {
+		return
+	}
+
+	toEnemy := enemy.Acked.Pos.Sub(player.Acked.Pos)
+	input.AimAngle = math.Atan2(toEnemy.Y, toEnemy.X) + (world.Rand.Float64()*2-1)*aimJitter
+	if player.Acked.BouncyEnergy >= world.Params.BouncyEnergyCost && world.Rand.Float64() < bouncyChance {
+		input.ShootSecondary = true
+	} else if world.Params.LaserEnabled && player.Acked.Energy >= world.Params.LaserEnergyCost {
+		input.ShootPrimary = true
+	}
+}
+
+// Follows the shortest path to the objective, or wanders for a while if we appear to be stuck
+func (b *Bot) move(world *entity.World, player *entity.Player, input *entity.PlayerInput) {
+	b.stuckTicks++
+	if b.stuckTicks >= stuckCheckTick {
+		moved := player.Acked.Pos.DistanceTo(b.lastPos)
+		if moved < world.Params.PlayerSpeed*stuckCheckTick/4 {
+			angle := world.Rand.Float64() * 2 * math.Pi
+			b.wanderDir = mymath.Vec{X: math.Cos(angle), Y: math.Sin(angle)}
+			b.wanderTicks = wanderTicks
+		}
+		b.lastPos = player.Acked.Pos
+		b.stuckTicks = 0
+	}
+
+	var dir mymath.Vec
+	if b.wanderTicks > 0 {
+		b.wanderTicks--
+		dir = b.wanderDir
+	} else {
+		target, ok := objective(world, player)
+		if !ok {
+			return
+		}
+		dir, ok = world.Map.PathDirection(player.Acked.Pos, target)
+		if !ok {
+			dir = target.Sub(player.Acked.Pos) // no path, e.g. target is out of reach in jail
+		}
+	}
+	setDirection(input, dir, world.Params.PlayerSpeed)
+}
+
+// Where the bot should be heading
+func objective(world *entity.World, player *entity.Player) (mymath.Vec, bool) {
+	pos := player.Acked.Pos
+
+	// Take a carried flag to one of our goals
+	if player.FlagIndex != -1 && player.Team != entity.TeamNone {
+		return closest(pos, world.Map.FlagGoals[player.Team])
+	}
+
+	// Go for flags that aren't already ours, including those carried by teammates to escort them
+	var flags []mymath.Vec
+	for i := range world.FlagList {
+		if world.FlagList[i].Team != player.Team {
+			flags = append(flags, world.FlagList[i].Pos)
+		}
+	}
+	if target, ok := closest(pos, flags); ok {
+		return target, true
+	}
+
+	// Hold hills, preferring those we don't own
+	var hills []mymath.Vec
+	for i := range world.Hills {
+		if world.Hills[i].Owner != player.Team {
+			hills = append(hills, world.Map.Hills[i].Centre())
+		}
+	}
+	if len(hills) == 0 && len(world.Hills) > 0 {
+		for i := range world.Map.Hills {
+			hills = append(hills, world.Map.Hills[i].Centre())
+		}
+	}
+	if target, ok := closest(pos, hills); ok {
+		return target, true
+	}
+
+	// Otherwise hunt down enemies
+	var enemies []mymath.Vec
+	for i := range world.PlayerList {
+		other := &world.PlayerList[i]
+		if other.State == entity.PlayerStateAlive && entity.IsHostile(player, other) {
+			enemies = append(enemies, other.Acked.Pos)
+		}
+	}
+	return closest(pos, enemies)
+}
+
+func closestVisibleEnemy(world *entity.World, player *entity.Player) *entity.Player {
+	var enemy *entity.Player
+	var enemyDist float64
+	for i := range world.PlayerList {
+		other := &world.PlayerList[i]
+		if other.State != entity.PlayerStateAlive || !entity.IsHostile(player, other) {
+			continue
+		}
+		dist := player.Acked.Pos.DistanceTo(other.Acked.Pos)
+		if dist > sightRange || (enemy != nil && dist >= enemyDist) {
+			continue
+		}
+		if !entity.LineOfSight(world, player.Acked.Pos, other.Acked.Pos) {
+			continue
+		}
+		enemy = other
+		enemyDist = dist
+	}
+	return enemy
+}
+
+func closest(pos mymath.Vec, locations []mymath.Vec) (mymath.Vec, bool) {
+	var best mymath.Vec
+	bestDist := -1.0
+	for _, loc := range locations {
+		dist := pos.DistanceTo(loc)
+		if bestDist == -1 || dist < bestDist {
+			best = loc
+			bestDist = dist
+		}
+	}
+	return best, bestDist != -1
+}
+
+// Converts a direction into the closest of the 8 directions a player can move in
+func setDirection(input *entity.PlayerInput, dir mymath.Vec, speed float64) {
+	length := dir.Length()
+	if length < speed {
+		return // close enough
+	}
+	const threshold = 0.38 // sin(22.5 degrees)
+	input.Left = dir.X < -threshold*length
+	input.Right = dir.X > threshold*length
+	input.Up = dir.Y > threshold*length
+	input.Down = dir.Y < -threshold*length
+}
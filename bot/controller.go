@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/web"
+)
+
+// Owns the bots playing in a world
+type Controller struct {
+	bots []*Bot
+}
+
+func NewController() Controller {
+	return Controller{}
+}
+
+// Counts the bots that are fill bots, or those that aren't
+func (c *Controller) Count(world *entity.World, fill bool) int {
+	count := 0
+	for _, b := range c.bots {
+		if player := world.FindPlayer(b.PlayerId); player != nil && player.FillBot == fill {
+			count++
+		}
+	}
+	return count
+}
+
+// Adds a bot player to the team, returns false if the world is full
+func (c *Controller) Add(world *entity.World, team int, fill bool) bool {
+	ok, id := world.NextPlayerId()
+	if !ok {
+		return false
+	}
+
+	player := entity.NewPlayer(id, team, web.Client{}, world.Params)
+	player.IsBot = true
+	player.FillBot = fill
+	player.Name = botName(world, &player)
+	player.Client.Username = player.Name
+	player.NetState = entity.PlayerNetStateReady
+	entity.EnterGame(world, &player)
+	world.PlayerList = append(world.PlayerList, player)
+	world.RosterChanged = true
+	world.ScoreboardChanged = true
+
+	c.bots = append(c.bots, newBot(id))
+	logger.Infof("added bot '%s' to team %d", player.Name, team)
+	return true
+}
+
+// Takes control of an existing bot player, e.g. one restored from a snapshot
+func (c *Controller) Adopt(player *entity.Player) {
+	c.bots = append(c.bots, newBot(player.Id))
+}
+
+// Removes the most recently added fill bot, or bot that isn't, returns false if there are none
+func (c *Controller) Remove(world *entity.World, fill bool) bool {
+	for i := len(c.bots) - 1; i >= 0; i-- {
+		player := world.FindPlayer(c.bots[i].PlayerId)
+		if player == nil || player.FillBot != fill {
+			continue
+		}
+		player.DoDisconnect = true
+		c.bots = append(c.bots[:i], c.bots[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// Generates inputs for every bot, should be called before players are updated
+func (c *Controller) Update(world *entity.World) {
+	for _, b := range c.bots {
+		player := world.FindPlayer(b.PlayerId)
+		if player == nil {
+			continue
+		}
+		input := b.think(world, player)
+		player.ReceivedInputs = append(player.ReceivedInputs[:0], input)
+		player.LastInput = input
+	}
+}
+
+func botName(world *entity.World, player *entity.Player) string {
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("Bot %d", n)
+		if entity.CheckName(world, player, name) == nil {
+			return name
+		}
+	}
+}
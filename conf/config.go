@@ -0,0 +1,175 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "CTF_"
+
+// Everything that can be configured, as laid out in a config file. Settings left out of the file keep their defaults.
+type Config struct {
+	ServerParams
+	Shared SharedParams
+	Match  MatchParams
+}
+
+// Settings given on the command line as Section.Field=value, e.g. Match.RoundsToWin=3
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ", ")
+}
+
+func (o *Overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+// Loads the config file, if any, then applies environment variables and the overrides in that order. Environment
+// variables are named after the setting, e.g. CTF_NETWORK_ADDR or CTF_SHARED_LASERSPEED. Nothing is changed unless the
+// resulting config is valid, otherwise the error describes every problem found.
+func Load(filename string, overrides Overrides) error {
+	config := Config{
+		ServerParams: Server,
+		Shared:       Shared,
+		Match:        Match,
+	}
+
+	if filename != "" {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+
+	var problems []string
+	forEachSetting(&config, func(path string, field reflect.Value, envName string) {
+		value, ok := os.LookupEnv(envName)
+		if !ok {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", envName, err))
+		}
+	})
+	for _, override := range overrides {
+		if err := config.set(override); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	problems = append(problems, config.ServerParams.validate()...)
+	if err := config.Shared.Validate(); err != nil {
+		problems = append(problems, "Shared."+err.Error())
+	}
+	problems = append(problems, config.Match.validate(config.Shared.TickRate)...)
+	if len(problems) > 0 {
+		return errors.New("bad config:\n\t" + strings.Join(problems, "\n\t"))
+	}
+
+	Server = config.ServerParams
+	Shared = config.Shared
+	Match = config.Match
+	return nil
+}
+
+// Writes every setting with its current value, as a starting point for a config file
+func WriteConfig(filename string) error {
+	config := Config{
+		ServerParams: Server,
+		Shared:       Shared,
+		Match:        Match,
+	}
+	bytes, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(bytes, '\n'), 0644)
+}
+
+// Applies a setting given as Section.Field=value
+func (c *Config) set(override string) error {
+	path, value, ok := strings.Cut(override, "=")
+	if !ok {
+		return fmt.Errorf("%s: expected Section.Field=value", override)
+	}
+	found := false
+	var err error
+	forEachSetting(c, func(settingPath string, field reflect.Value, envName string) {
+		if strings.EqualFold(settingPath, path) {
+			found = true
+			err = setField(field, value)
+		}
+	})
+	if !found {
+		return fmt.Errorf("%s: no such setting", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Calls fn with the path (e.g. Network.Addr), value and environment variable name of every setting
+func forEachSetting(config *Config, fn func(path string, field reflect.Value, envName string)) {
+	sections := []struct {
+		name  string
+		value reflect.Value
+	}{
+		{"Network", reflect.ValueOf(&config.Network).Elem()},
+		{"Paths", reflect.ValueOf(&config.Paths).Elem()},
+		{"Log", reflect.ValueOf(&config.Log).Elem()},
+		{"Shared", reflect.ValueOf(&config.Shared).Elem()},
+		{"Match", reflect.ValueOf(&config.Match).Elem()},
+	}
+	for _, section := range sections {
+		for i := 0; i < section.value.NumField(); i++ {
+			field := section.value.Type().Field(i)
+			envName := field.Tag.Get("env")
+			if envName == "" {
+				envName = envPrefix + strings.ToUpper(section.name+"_"+field.Name)
+			}
+			fn(section.name+"."+field.Name, section.value.Field(i), envName)
+		}
+	}
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a whole number", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not true or false", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Kind())
+	}
+	return nil
+}
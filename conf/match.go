@@ -0,0 +1,116 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Server side rules for the lifecycle of a match (not shared with clients)
+type MatchParams struct {
+	MinPlayers        int // ready players needed before warmup begins
+	WarmupSecs        int
+	RoundTimeSecs     int // 0 for no time limit
+	OvertimeSecs      int // 0 for sudden death until someone scores
+	IntermissionSecs  int
+	MatchOverSecs     int
+	RoundsToWin       int
+	MapShuffle        bool // play maps in a random order instead of by name
+	MapVoteCandidates int  // maps to choose from when a match is over, 0 to disable voting
+	HillControlSecs   int  // king of the hill, seconds of control a team needs to win a round, 0 for time limited rounds
+	FragLimit         int  // deathmatch, kills needed to win a round, 0 for time limited rounds
+	Jailbreak         bool // teammates can free jailed players by touching a jail release tile
+	FlagReturnSecs    int  // dropped flags go back to their spawn after this long untouched, 0 to disable
+	FlagOwnerReturn   bool // a team can return a flag stolen from their goal by touching it
+	BotFill           int  // bots are added until there are this many players, 0 to disable
+}
+
+// Clients have a key to vote for each of this many maps
+const MaxMapVoteCandidates = 3
+
+var Match = MatchParams{
+	MinPlayers:        2,
+	WarmupSecs:        15,
+	RoundTimeSecs:     600,
+	OvertimeSecs:      120,
+	IntermissionSecs:  10,
+	MatchOverSecs:     20,
+	RoundsToWin:       2,
+	MapShuffle:        false,
+	MapVoteCandidates: 3,
+	HillControlSecs:   120,
+	FragLimit:         25,
+	Jailbreak:         false,
+	FlagReturnSecs:    30,
+	FlagOwnerReturn:   true,
+	BotFill:           0,
+}
+
+func SecsToTicks(secs int) int {
+	return secs * Shared.TickRate
+}
+
+// Returns a description of every param that doesn't make sense, when played at the tick rate
+func (m *MatchParams) validate(tickRate int) []string {
+	var problems []string
+	value := reflect.ValueOf(*m)
+	for i := 0; i < value.NumField(); i++ {
+		if value.Field(i).Kind() == reflect.Int && value.Field(i).Int() < 0 {
+			problems = append(problems, fmt.Sprintf("Match.%s can't be negative", value.Type().Field(i).Name))
+		}
+	}
+	for _, param := range []struct {
+		name  string
+		count int
+	}{
+		{"MinPlayers", m.MinPlayers},
+		{"RoundsToWin", m.RoundsToWin},
+	} {
+		if param.count < 1 {
+			problems = append(problems, fmt.Sprintf("Match.%s must be at least 1", param.name))
+		}
+	}
+	if m.MapVoteCandidates > MaxMapVoteCandidates {
+		problems = append(problems, fmt.Sprintf("Match.MapVoteCandidates can't be more than %d", MaxMapVoteCandidates))
+	}
+	if tickRate > 0 && m.HillControlSecs > math.MaxUint16/tickRate {
+		// Clients are sent hill control in ticks as 16 bit numbers
+		problems = append(problems, fmt.Sprintf("Match.HillControlSecs can't be more than %d", math.MaxUint16/tickRate))
+	}
+	if m.RoundTimeSecs == 0 {
+		// Otherwise rounds of a mode could never end
+		for _, param := range []struct {
+			name  string
+			limit int
+		}{
+			{"HillControlSecs", m.HillControlSecs},
+			{"FragLimit", m.FragLimit},
+		} {
+			if param.limit == 0 {
+				problems = append(problems, fmt.Sprintf("Match.%s can only be 0 when there is a RoundTimeSecs", param.name))
+			}
+		}
+	}
+	return problems
+}
+
+// Applies a JSON object holding some of the params to a copy of m. MapShuffle is rejected since the map rotation is set
+// up when a room opens.
+func (m MatchParams) WithChanges(changes []byte) (MatchParams, error) {
+	updated := m
+	decoder := json.NewDecoder(bytes.NewReader(changes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		return m, err
+	}
+	if problems := updated.validate(Shared.TickRate); len(problems) > 0 {
+		return m, errors.New(problems[0])
+	}
+	if updated.MapShuffle != m.MapShuffle {
+		return m, errors.New("MapShuffle can't be changed while a game is running")
+	}
+	return updated, nil
+}
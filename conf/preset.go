@@ -0,0 +1,64 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	presetExt         = ".json"
+	maxPresetNameLen  = 32
+	DefaultPresetName = "default"
+)
+
+// Named rules that override some of the shared params, e.g. instagib
+type Preset struct {
+	Name    string
+	Changes json.RawMessage // JSON object holding the params that differ from the defaults
+}
+
+var DefaultPreset = Preset{Name: DefaultPresetName, Changes: json.RawMessage("{}")}
+
+// Returns the params the preset gives when applied over base
+func (p Preset) Apply(base SharedParams) (SharedParams, error) {
+	params, _, err := base.WithChanges(p.Changes)
+	return params, err
+}
+
+// Loads every preset file in a directory, each named after its file. The default preset is always included, but can be
+// overridden by a file of the same name. An empty dir gives only the default preset.
+func LoadPresets(dir string) (map[string]Preset, error) {
+	presets := map[string]Preset{DefaultPresetName: DefaultPreset}
+	if dir == "" {
+		return presets, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != presetExt {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		preset := Preset{
+			Name:    strings.TrimSuffix(entry.Name(), presetExt),
+			Changes: data,
+		}
+		if len(preset.Name) > maxPresetNameLen {
+			return nil, fmt.Errorf("preset %s: name is longer than %d characters", filename, maxPresetNameLen)
+		}
+		if _, err := preset.Apply(Shared); err != nil {
+			return nil, fmt.Errorf("preset %s: %w", filename, err)
+		}
+		presets[preset.Name] = preset
+	}
+	return presets, nil
+}
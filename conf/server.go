@@ -0,0 +1,111 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kjander0/ctf/logger"
+)
+
+// Server side settings that don't affect the rules of the game
+type ServerParams struct {
+	Network NetworkParams
+	Paths   PathParams
+	Log     LogParams
+}
+
+type NetworkParams struct {
+	Addr            string // address browsers connect to for the web client and the game
+	AdminAddr       string // address for the admin API to listen on, empty to disable it
+	AdminToken      string `env:"CTF_ADMIN_TOKEN"` // token admin API requests must carry
+	ConnTimeoutSecs int    // connections are closed after going quiet this long
+	PingSecs        int    // how often clients are pinged, must be less than ConnTimeoutSecs
+	MaxMessageBytes int    // largest message accepted from a client
+	DelayMs         int    // artificial delay added to every message, for testing
+	JitterMs        int    // artificial delay is randomly varied by up to this much
+	LossRate        float64
+}
+
+type PathParams struct {
+	WWW       string // web client served to browsers, shared.json is written here
+	Maps      string
+	Presets   string // directory of rule presets rooms can be opened with, empty for the default rules only
+	Records   string // directory to record a replay of every room to, empty to disable recording
+	Snapshots string // directory to save rooms to on shutdown and restore them from on startup, empty to disable
+}
+
+type LogParams struct {
+	Level string // debug, info or error
+	File  string // file to append the log to as well as stderr, empty for stderr only
+}
+
+var Server = ServerParams{
+	Network: NetworkParams{
+		Addr:            ":8000",
+		ConnTimeoutSecs: 10,
+		PingSecs:        5,
+		MaxMessageBytes: 1024,
+	},
+	Paths: PathParams{
+		WWW:     "www",
+		Maps:    "www/assets/maps",
+		Presets: "presets",
+	},
+	Log: LogParams{
+		Level: "debug",
+	},
+}
+
+// Returns a description of every setting that doesn't make sense
+func (s *ServerParams) validate() []string {
+	var problems []string
+	network := &s.Network
+	if network.Addr == "" {
+		problems = append(problems, "Network.Addr must be set")
+	}
+	if network.AdminAddr != "" && network.AdminToken == "" {
+		problems = append(problems, "Network.AdminToken must be set to enable the admin API")
+	}
+	if network.ConnTimeoutSecs <= 0 {
+		problems = append(problems, "Network.ConnTimeoutSecs must be greater than zero")
+	}
+	if network.PingSecs <= 0 || network.PingSecs >= network.ConnTimeoutSecs {
+		problems = append(problems, "Network.PingSecs must be greater than zero and less than Network.ConnTimeoutSecs")
+	}
+	if network.MaxMessageBytes <= 0 {
+		problems = append(problems, "Network.MaxMessageBytes must be greater than zero")
+	}
+	if network.DelayMs < 0 || network.JitterMs < 0 {
+		problems = append(problems, "Network.DelayMs and Network.JitterMs can't be negative")
+	}
+	if network.LossRate < 0 || network.LossRate > 1 {
+		problems = append(problems, "Network.LossRate must be between 0 and 1")
+	}
+
+	for _, dir := range []struct {
+		name     string
+		path     string
+		optional bool
+	}{
+		{"Paths.WWW", s.Paths.WWW, false},
+		{"Paths.Maps", s.Paths.Maps, false},
+		{"Paths.Presets", s.Paths.Presets, true},
+		{"Paths.Records", s.Paths.Records, true},
+		{"Paths.Snapshots", s.Paths.Snapshots, true},
+	} {
+		if dir.path == "" {
+			if !dir.optional {
+				problems = append(problems, dir.name+" must be set")
+			}
+			continue
+		}
+		if info, err := os.Stat(dir.path); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("%s: %s is not a directory", dir.name, dir.path))
+		}
+	}
+
+	if _, ok := logger.ParseLevel(s.Log.Level); !ok {
+		problems = append(problems, fmt.Sprintf("Log.Level: unknown level '%s', must be debug, info or error", s.Log.Level))
+	}
+	return problems
+}
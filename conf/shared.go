@@ -1,8 +1,11 @@
 package conf
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"reflect"
 
 	"github.com/kjander0/ctf/logger"
 )
@@ -19,6 +22,7 @@ type SharedParams struct {
 	LaserSpeed       float64
 	LaserTimeTicks   int
 	LaserEnergyCost  int
+	LaserEnabled     bool // false leaves players with only bouncy shots
 	BouncyEnergyCost int
 	BouncySpeed      float64
 	MaxBounces       int
@@ -36,6 +40,7 @@ var Shared = SharedParams{
 	LaserSpeed:       10,
 	LaserTimeTicks:   60,
 	LaserEnergyCost:  18,
+	LaserEnabled:     true,
 	BouncyEnergyCost: 90,
 	BouncySpeed:      15,
 	MaxBounces:       5,
@@ -48,3 +53,64 @@ func WriteSharedParams(filePath string) {
 	}
 	os.WriteFile(filePath, bytes, 0644)
 }
+
+// Params that can't change while a game is running, the tick loop and map navigation depend on them
+var fixedParams = map[string]bool{
+	"TickRate":     true,
+	"TileSize":     true,
+	"PlayerRadius": true,
+}
+
+// Returns an error describing the first param that doesn't make sense
+func (p *SharedParams) Validate() error {
+	value := reflect.ValueOf(*p)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		positive := true
+		switch field.Kind() {
+		case reflect.Int:
+			positive = field.Int() > 0
+		case reflect.Float64:
+			positive = field.Float() > 0
+		}
+		if !positive {
+			return fmt.Errorf("%s must be greater than zero", value.Type().Field(i).Name)
+		}
+	}
+	return nil
+}
+
+// Applies a JSON object holding some of the params to a copy of p, returns the copy and the names of the params that
+// changed. Unknown params and those that can't change while a game is running are rejected.
+func (p SharedParams) WithChanges(changes []byte) (SharedParams, []string, error) {
+	updated := p
+	decoder := json.NewDecoder(bytes.NewReader(changes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		return p, nil, err
+	}
+	if err := updated.Validate(); err != nil {
+		return p, nil, err
+	}
+
+	changed := p.Diff(updated)
+	for _, name := range changed {
+		if fixedParams[name] {
+			return p, nil, fmt.Errorf("%s can't be changed while a game is running", name)
+		}
+	}
+	return updated, changed, nil
+}
+
+// Returns the names of the params that differ between p and other
+func (p SharedParams) Diff(other SharedParams) []string {
+	var changed []string
+	before := reflect.ValueOf(p)
+	after := reflect.ValueOf(other)
+	for i := 0; i < before.NumField(); i++ {
+		if before.Field(i).Interface() != after.Field(i).Interface() {
+			changed = append(changed, before.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
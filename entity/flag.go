@@ -2,20 +2,26 @@ package entity
 
 import (
 	"github.com/kjander0/ctf/conf"
-	"github.com/kjander0/ctf/logger"
 	"github.com/kjander0/ctf/mymath"
 )
 
 type Flag struct {
-	Held bool
-	Team int // -1 if not delivered to a goal yet
-	Pos  mymath.Vec
+	Held         bool
+	Team         int // -1 if not delivered to a goal yet
+	Pos          mymath.Vec
+	Spawn        mymath.Vec
+	Dropped      bool       // lying where its carrier dropped it
+	DroppedTicks int        // ticks since it was dropped
+	LastTeam     int        // team it was last delivered by, -1 if never delivered
+	LastGoal     mymath.Vec // goal it was last delivered to
 }
 
 func NewFlag(pos mymath.Vec) Flag {
 	return Flag{
-		Pos:  pos,
-		Team: -1,
+		Pos:      pos,
+		Spawn:    pos,
+		Team:     -1,
+		LastTeam: -1,
 	}
 }
 
@@ -40,6 +46,19 @@ func UpdateFlags(world *World) {
 				flag.Pos = player.Acked.Pos
 				tryDeliverFlag(world, flag, player)
 			}
+			if !flag.Held && flag.Team == -1 {
+				flag.Dropped = true
+				flag.DroppedTicks = 0
+			}
+		}
+
+		if flag.Dropped {
+			flag.DroppedTicks++
+			returnTicks := conf.SecsToTicks(world.Rules.FlagReturnSecs)
+			if returnTicks > 0 && flag.DroppedTicks >= returnTicks {
+				flag.Pos = flag.Spawn
+				flag.Dropped = false
+			}
 		}
 
 		if !flag.Held {
@@ -65,7 +84,14 @@ func UpdateFlags(world *World) {
 				}
 			}
 
-			if closestPlayer != nil {
+			if closestPlayer != nil && flag.Dropped && closestPlayer.Team == flag.LastTeam && world.Rules.FlagOwnerReturn {
+				// Stolen from this team's goal, so touching it takes it back there
+				flag.Team = flag.LastTeam
+				flag.Pos = flag.LastGoal
+				flag.Dropped = false
+				recordReturn(world, closestPlayer)
+			} else if closestPlayer != nil {
+				flag.Dropped = false
 				closestPlayer.FlagIndex = i
 				flag.Held = true
 				flag.Team = -1
@@ -73,48 +99,22 @@ func UpdateFlags(world *World) {
 			}
 		}
 	}
-
-	numGreen := 0
-	numRed := 0
-	for i := range world.FlagList {
-		flag := &world.FlagList[i]
-		switch flag.Team {
-		case TeamGreen:
-			numGreen++
-		case TeamRed:
-			numRed++
-		}
-	}
-
-	numFlags := len(world.FlagList)
-	if numGreen == numFlags {
-		world.WinningTeam = TeamGreen
-	} else if numRed == numFlags {
-		world.WinningTeam = TeamRed
-	}
-
-	if world.WinningTeam != -1 && world.WinCooldownTicks == 0 {
-		world.WinCooldownTicks = 150
-	}
 }
 
 func tryDeliverFlag(world *World, flag *Flag, player *Player) {
-	var flagGoals []mymath.Vec
-	switch player.Team {
-	case TeamGreen:
-		flagGoals = world.Map.GreenFlagGoals
-	case TeamRed:
-		flagGoals = world.Map.RedFlagGoals
-	default:
-		logger.Panic("unsupported team")
+	if player.Team == TeamNone {
+		return // no goals to deliver to
 	}
-
-	for _, goalPos := range flagGoals {
+	for _, goalPos := range world.Map.FlagGoals[player.Team] {
 		if flag.Pos.DistanceTo(goalPos) < float64(conf.Shared.TileSize) {
 			flag.Team = player.Team
 			flag.Pos = goalPos
 			flag.Held = false
+			flag.LastTeam = player.Team
+			flag.LastGoal = goalPos
 			player.FlagIndex = -1
+			recordCapture(world, player)
+			return
 		}
 	}
 }
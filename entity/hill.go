@@ -0,0 +1,60 @@
+package entity
+
+// Control state of a capture zone (hill) on the map
+type Hill struct {
+	Owner     int // team that controlled the hill most recently, -1 if never controlled
+	Contested bool
+	Control   [NumTeams]int // ticks each team has controlled the hill for
+}
+
+func NewHill() Hill {
+	return Hill{
+		Owner: -1,
+	}
+}
+
+// The team with the most alive players on a hill controls it, progress is frozen while teams are tied
+func UpdateHills(world *World) {
+	for i := range world.Hills {
+		hill := &world.Hills[i]
+		area := &world.Map.Hills[i]
+
+		var counts [NumTeams]int
+		for j := range world.PlayerList {
+			player := &world.PlayerList[j]
+			if player.State != PlayerStateAlive || player.Team == TeamNone || !area.Contains(player.Acked.Pos) {
+				continue
+			}
+			counts[player.Team]++
+		}
+
+		leader := -1
+		hill.Contested = false
+		for team := 0; team < NumTeams; team++ {
+			if counts[team] == 0 {
+				continue
+			}
+			if leader == -1 || counts[team] > counts[leader] {
+				leader = team
+				hill.Contested = false
+			} else if counts[team] == counts[leader] {
+				hill.Contested = true
+			}
+		}
+
+		if leader == -1 || hill.Contested {
+			continue
+		}
+		hill.Owner = leader
+		hill.Control[leader]++
+	}
+}
+
+// Total ticks a team has controlled hills for
+func (w *World) HillControl(team int) int {
+	total := 0
+	for i := range w.Hills {
+		total += w.Hills[i].Control[team]
+	}
+	return total
+}
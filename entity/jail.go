@@ -0,0 +1,51 @@
+package entity
+
+import "github.com/kjander0/ctf/mymath"
+
+// A team's players being freed from a jail by a teammate
+type Jailbreak struct {
+	Team int
+	Pos  mymath.Vec // centre of the jail
+}
+
+// An alive player touching their team's jail release tiles frees every teammate in the paired jail
+func UpdateJailbreaks(world *World) {
+	world.NewJailbreaks = world.NewJailbreaks[:0]
+	if !world.Match.Jailbreak || world.Match.Frozen() {
+		return
+	}
+
+	for i := range world.Map.JailReleases {
+		release := &world.Map.JailReleases[i]
+		if !teamOnArea(world, release.Team, &release.Area) {
+			continue
+		}
+
+		freed := 0
+		for j := range world.PlayerList {
+			player := &world.PlayerList[j]
+			if player.State != PlayerStateJailed || player.Team != release.Team || !release.Jail.Contains(player.Acked.Pos) {
+				continue
+			}
+			releaseFromJail(world, player)
+			freed++
+		}
+
+		if freed > 0 {
+			world.NewJailbreaks = append(world.NewJailbreaks, Jailbreak{
+				Team: release.Team,
+				Pos:  release.Jail.Centre(),
+			})
+		}
+	}
+}
+
+func teamOnArea(world *World, team int, area *TileArea) bool {
+	for i := range world.PlayerList {
+		player := &world.PlayerList[i]
+		if player.State == PlayerStateAlive && player.Team == team && area.Contains(player.Acked.Pos) {
+			return true
+		}
+	}
+	return false
+}
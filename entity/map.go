@@ -1,10 +1,14 @@
 package entity
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"io"
-	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/kjander0/ctf/conf"
 	"github.com/kjander0/ctf/logger"
@@ -58,6 +62,13 @@ var TileTypeYellowFlagGoal = NewTileType()
 
 var TileTypeFlagSpawn = NewTileType()
 
+var TileTypeCaptureZone = NewTileType()
+
+var TileTypeGreenJailRelease = NewTileType()
+var TileTypeRedJailRelease = NewTileType()
+var TileTypeBlueJailRelease = NewTileType()
+var TileTypeYellowJailRelease = NewTileType()
+
 func init() {
 	TileTypeEmpty.CollisionGroup = 0
 	TileTypeFloor.CollisionGroup = 0
@@ -72,7 +83,7 @@ func init() {
 	TileTypeYellowSpawn.CollisionGroup = 0
 
 	TileTypeGreenJail.Team = TeamGreen
-	TileTypeGreenSpawn.CollisionGroup = 0
+	TileTypeGreenJail.CollisionGroup = 0
 	TileTypeRedJail.Team = TeamRed
 	TileTypeRedJail.CollisionGroup = 0
 	TileTypeBlueJail.Team = TeamBlue
@@ -88,6 +99,17 @@ func init() {
 	TileTypeBlueFlagGoal.CollisionGroup = 0
 	TileTypeYellowFlagGoal.Team = TeamYellow
 	TileTypeYellowFlagGoal.CollisionGroup = 0
+
+	TileTypeCaptureZone.CollisionGroup = 0
+
+	TileTypeGreenJailRelease.Team = TeamGreen
+	TileTypeGreenJailRelease.CollisionGroup = 0
+	TileTypeRedJailRelease.Team = TeamRed
+	TileTypeRedJailRelease.CollisionGroup = 0
+	TileTypeBlueJailRelease.Team = TeamBlue
+	TileTypeBlueJailRelease.CollisionGroup = 0
+	TileTypeYellowJailRelease.Team = TeamYellow
+	TileTypeYellowJailRelease.CollisionGroup = 0
 }
 
 type Tile struct {
@@ -101,40 +123,90 @@ type Tile struct {
 	Orientation uint8
 }
 
+// Map files may start with the magic string and a length prefixed JSON header holding MapOverrides
+const mapMagic = "CTFMAP"
+
+// Gameplay values that differ from the room's while a map is being played, e.g. a faster PlayerSpeed on a huge map
+type MapOverrides struct {
+	Shared json.RawMessage `json:",omitempty"` // JSON object holding some of conf.SharedParams
+	Match  json.RawMessage `json:",omitempty"` // JSON object holding some of conf.MatchParams
+}
+
 type Map struct {
-	Rows           [][]Tile
-	GreenJails     []mymath.Vec
-	RedJails       []mymath.Vec
-	GreenSpawns    []mymath.Vec
-	RedSpawns      []mymath.Vec
-	FlagSpawns     []mymath.Vec
-	GreenFlagGoals []mymath.Vec
-	RedFlagGoals   []mymath.Vec
+	Name       string
+	Data       []byte // contents of the map file, as sent to clients
+	Overrides  MapOverrides
+	Rows       [][]Tile
+	Jails      [NumTeams][]mymath.Vec // indexed by team
+	Spawns     [NumTeams][]mymath.Vec
+	FlagGoals  [NumTeams][]mymath.Vec
+	FlagSpawns []mymath.Vec
+	Hills      []TileArea // contiguous areas of capture zone tiles
+
+	JailReleases []JailRelease
+
+	navGrid navGrid // for path queries
+}
+
+// Contiguous group of tiles of the same type
+type TileArea struct {
+	Tiles []mymath.Vec // bottom left of each tile
+}
+
+// Area of jail release tiles and the jail it opens
+type JailRelease struct {
+	Team int
+	Area TileArea
+	Jail TileArea // the team's jail closest to the release tiles
 }
 
 func LoadMap(filename string) *Map {
-	file, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		// TODO: test this error
 		logger.Panic("File not found: ", filename)
 	}
-	defer file.Close()
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return DecodeMap(name, data)
+}
+
+// Decodes a map from the contents of a map file
+func DecodeMap(name string, data []byte) *Map {
+	reader := bytes.NewReader(data)
+	newMap := &Map{
+		Name: name,
+		Data: data,
+	}
+
+	if bytes.HasPrefix(data, []byte(mapMagic)) {
+		reader.Seek(int64(len(mapMagic)), io.SeekStart)
+		var headerLen uint16
+		if err := binary.Read(reader, binary.BigEndian, &headerLen); err != nil {
+			logger.Panic("Failed to read header length from map: ", name)
+		}
+		header := make([]byte, headerLen)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			logger.Panic("Failed to read header from map: ", name)
+		}
+		if err := json.Unmarshal(header, &newMap.Overrides); err != nil {
+			logger.Panicf("Bad header in map %s: %v", name, err)
+		}
+	}
 
 	var rowSize uint16
-	err = binary.Read(file, binary.BigEndian, &rowSize)
+	err := binary.Read(reader, binary.BigEndian, &rowSize)
 	if err != nil {
-		logger.Panic("Failed to read rowSize from file: ", filename)
+		logger.Panic("Failed to read rowSize from map: ", name)
 	}
 
-	newMap := &Map{}
 	newMap.Rows = append(newMap.Rows, []Tile{})
 	for {
 		var bits uint16
-		err = binary.Read(file, binary.BigEndian, &bits)
+		err = binary.Read(reader, binary.BigEndian, &bits)
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			logger.Panic("Failed to read from file: ", filename)
+			logger.Panic("Failed to read from map: ", name)
 		}
 
 		tileCount := (bits & ^(^0 << 5)) + 1
@@ -162,30 +234,203 @@ func LoadMap(filename string) *Map {
 				Orientation: uint8(orientation),
 			})
 
+			centre := TileCentre(rowIndex, colIndex)
 			switch tileType {
-			case TileTypeGreenJail:
-				newMap.GreenJails = append(newMap.GreenJails, TileCentre(rowIndex, colIndex))
-			case TileTypeRedJail:
-				newMap.RedJails = append(newMap.RedJails, TileCentre(rowIndex, colIndex))
-			case TileTypeGreenSpawn:
-				newMap.GreenSpawns = append(newMap.GreenSpawns, TileCentre(rowIndex, colIndex))
-			case TileTypeRedSpawn:
-				newMap.RedSpawns = append(newMap.RedSpawns, TileCentre(rowIndex, colIndex))
+			case TileTypeGreenJail, TileTypeRedJail, TileTypeBlueJail, TileTypeYellowJail:
+				newMap.Jails[tileType.Team] = append(newMap.Jails[tileType.Team], centre)
+			case TileTypeGreenSpawn, TileTypeRedSpawn, TileTypeBlueSpawn, TileTypeYellowSpawn:
+				newMap.Spawns[tileType.Team] = append(newMap.Spawns[tileType.Team], centre)
+			case TileTypeGreenFlagGoal, TileTypeRedFlagGoal, TileTypeBlueFlagGoal, TileTypeYellowFlagGoal:
+				newMap.FlagGoals[tileType.Team] = append(newMap.FlagGoals[tileType.Team], centre)
 			case TileTypeFlagSpawn:
-				newMap.FlagSpawns = append(newMap.FlagSpawns, TileCentre(rowIndex, colIndex))
-			case TileTypeGreenFlagGoal:
-				newMap.GreenFlagGoals = append(newMap.GreenFlagGoals, TileCentre(rowIndex, colIndex))
-			case TileTypeRedFlagGoal:
-				newMap.RedFlagGoals = append(newMap.RedFlagGoals, TileCentre(rowIndex, colIndex))
+				newMap.FlagSpawns = append(newMap.FlagSpawns, centre)
 			}
 		}
 	}
 
+	newMap.Hills = newMap.findAreas(TileTypeCaptureZone)
+	newMap.JailReleases = newMap.findJailReleases()
+
+	for team := 0; team < NumTeams; team++ {
+		if len(newMap.Spawns[team]) > 0 && len(newMap.Jails[team]) == 0 {
+			logger.Panicf("Team %d has spawns but no jail in map: %s", team, name)
+		}
+	}
+
 	return newMap
 }
 
-func (m *Map) RandomLocation(locations []mymath.Vec) mymath.Vec {
-	return locations[rand.Intn(len(locations))]
+// Teams that can be played on this map (those with spawn tiles)
+func (m *Map) Teams() []int {
+	var teams []int
+	for team := 0; team < NumTeams; team++ {
+		if len(m.Spawns[team]) > 0 {
+			teams = append(teams, team)
+		}
+	}
+	return teams
+}
+
+func (m *Map) HasTeam(team int) bool {
+	return team >= 0 && team < NumTeams && len(m.Spawns[team]) > 0
+}
+
+// Shared params while this map is being played
+func (m *Map) Params(base conf.SharedParams) (conf.SharedParams, error) {
+	if len(m.Overrides.Shared) == 0 {
+		return base, nil
+	}
+	params, _, err := base.WithChanges(m.Overrides.Shared)
+	return params, err
+}
+
+// Match rules while this map is being played
+func (m *Map) Rules(base conf.MatchParams) (conf.MatchParams, error) {
+	if len(m.Overrides.Match) == 0 {
+		return base, nil
+	}
+	return base.WithChanges(m.Overrides.Match)
+}
+
+// Checks that the overrides are valid, and that players can reach every objective and each other's spawns from their
+// own spawns
+func (m *Map) Validate() error {
+	if _, err := m.Params(conf.Shared); err != nil {
+		return fmt.Errorf("shared param overrides: %w", err)
+	}
+	if _, err := m.Rules(conf.Match); err != nil {
+		return fmt.Errorf("match rule overrides: %w", err)
+	}
+
+	var targets []mymath.Vec
+	targets = append(targets, m.FlagSpawns...)
+	for i := range m.Hills {
+		targets = append(targets, m.Hills[i].Centre())
+	}
+	for _, team := range m.Teams() {
+		targets = append(targets, m.FlagGoals[team]...)
+		targets = append(targets, m.Spawns[team]...)
+	}
+
+	for _, team := range m.Teams() {
+		for _, spawn := range m.Spawns[team] {
+			for _, target := range targets {
+				if _, ok := m.PathDistance(spawn, target); !ok {
+					return fmt.Errorf("no path from team %d spawn at %v to %v", team, spawn, target)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Spawn locations of a team, or every spawn location for TeamNone
+func (m *Map) TeamSpawns(team int) []mymath.Vec {
+	if team == TeamNone {
+		return allLocations(m.Spawns)
+	}
+	return m.Spawns[team]
+}
+
+// Jail locations of a team, or every jail location for TeamNone
+func (m *Map) TeamJails(team int) []mymath.Vec {
+	if team == TeamNone {
+		return allLocations(m.Jails)
+	}
+	return m.Jails[team]
+}
+
+func allLocations(byTeam [NumTeams][]mymath.Vec) []mymath.Vec {
+	var locations []mymath.Vec
+	for team := range byTeam {
+		locations = append(locations, byTeam[team]...)
+	}
+	return locations
+}
+
+// Pairs each area of jail release tiles with the closest jail of the same team
+func (m *Map) findJailReleases() []JailRelease {
+	var releases []JailRelease
+	jailTypes := []*TileType{TileTypeGreenJail, TileTypeRedJail, TileTypeBlueJail, TileTypeYellowJail}
+	releaseTypes := []*TileType{TileTypeGreenJailRelease, TileTypeRedJailRelease, TileTypeBlueJailRelease, TileTypeYellowJailRelease}
+	for team := 0; team < NumTeams; team++ {
+		jails := m.findAreas(jailTypes[team])
+		if len(jails) == 0 {
+			continue
+		}
+		for _, area := range m.findAreas(releaseTypes[team]) {
+			closest := 0
+			for i := range jails {
+				if jails[i].Centre().DistanceTo(area.Centre()) < jails[closest].Centre().DistanceTo(area.Centre()) {
+					closest = i
+				}
+			}
+			releases = append(releases, JailRelease{
+				Team: team,
+				Area: area,
+				Jail: jails[closest],
+			})
+		}
+	}
+	return releases
+}
+
+// Flood fills to find areas of connected tiles with the given type
+func (m *Map) findAreas(tileType *TileType) []TileArea {
+	var areas []TileArea
+	visited := map[[2]int]bool{}
+	for r := range m.Rows {
+		for c := range m.Rows[r] {
+			if m.Rows[r][c].Type != tileType || visited[[2]int{r, c}] {
+				continue
+			}
+
+			area := TileArea{}
+			stack := [][2]int{{r, c}}
+			visited[[2]int{r, c}] = true
+			for len(stack) > 0 {
+				rc := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				area.Tiles = append(area.Tiles, m.Rows[rc[0]][rc[1]].Pos)
+
+				for _, offset := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+					next := [2]int{rc[0] + offset[0], rc[1] + offset[1]}
+					if next[0] < 0 || next[0] >= len(m.Rows) || next[1] < 0 || next[1] >= len(m.Rows[next[0]]) {
+						continue
+					}
+					if visited[next] || m.Rows[next[0]][next[1]].Type != tileType {
+						continue
+					}
+					visited[next] = true
+					stack = append(stack, next)
+				}
+			}
+			areas = append(areas, area)
+		}
+	}
+	return areas
+}
+
+func (a *TileArea) Contains(pos mymath.Vec) bool {
+	tileSize := float64(conf.Shared.TileSize)
+	tileRect := mymath.Rect{Size: mymath.Vec{X: tileSize, Y: tileSize}}
+	for _, tilePos := range a.Tiles {
+		tileRect.Pos = tilePos
+		if tileRect.ContainsPoint(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// Average of tile centres
+func (a *TileArea) Centre() mymath.Vec {
+	halfTile := float64(conf.Shared.TileSize) / 2
+	var sum mymath.Vec
+	for _, tilePos := range a.Tiles {
+		sum = sum.Add(tilePos.AddXY(halfTile, halfTile))
+	}
+	return sum.Scale(1 / float64(len(a.Tiles)))
 }
 
 func (m *Map) SampleTiles(pos mymath.Vec, radius float64, collisionGroup int) []Tile {
@@ -257,9 +502,9 @@ func (t Tile) CalcTrianglePoints() (mymath.Vec, mymath.Vec, mymath.Vec) {
 }
 
 func TileCentre(row int, col int) mymath.Vec {
-	return mymath.Vec{float64(col) + 0.5, float64(row) + 0.5}.Scale(float64(conf.Shared.TileSize))
+	return mymath.Vec{X: float64(col) + 0.5, Y: float64(row) + 0.5}.Scale(float64(conf.Shared.TileSize))
 }
 
 func TileBottomLeft(row int, col int) mymath.Vec {
-	return mymath.Vec{float64(col), float64(row)}.Scale(float64(conf.Shared.TileSize))
+	return mymath.Vec{X: float64(col), Y: float64(row)}.Scale(float64(conf.Shared.TileSize))
 }
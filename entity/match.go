@@ -0,0 +1,42 @@
+package entity
+
+import "github.com/kjander0/ctf/conf"
+
+const (
+	MatchPhaseWaiting = iota // not enough players
+	MatchPhaseWarmup
+	MatchPhaseLive
+	MatchPhaseOvertime
+	MatchPhaseIntermission // between rounds
+	MatchPhaseOver
+)
+
+type Match struct {
+	Phase       int
+	PhaseTicks  int // ticks remaining in current phase, 0 if phase is untimed
+	Round       int
+	RoundWins   [NumTeams]int // free-for-all round wins are kept in PlayerStats instead
+	Scores      [NumTeams]int // score of each team in the current round, as decided by the game mode
+	RoundWinner int           // team, or player id in free-for-all, -1 if last round was a draw
+	MatchWinner int           // -1 until match is over
+	Jailbreak   bool          // jailed players can be freed by teammates
+}
+
+func NewMatch(rules conf.MatchParams) Match {
+	return Match{
+		Phase:       MatchPhaseWaiting,
+		RoundWinner: -1,
+		MatchWinner: -1,
+		Jailbreak:   rules.Jailbreak,
+	}
+}
+
+// Returns true if objectives (e.g. flag captures) count towards winning a round
+func (m *Match) InPlay() bool {
+	return m.Phase == MatchPhaseLive || m.Phase == MatchPhaseOvertime
+}
+
+// Returns true between rounds, when objectives are not updated
+func (m *Match) Frozen() bool {
+	return m.Phase == MatchPhaseIntermission || m.Phase == MatchPhaseOver
+}
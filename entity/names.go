@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MaxNameLen = 16
+)
+
+// Checks a display name requested by a player, returns an error explaining why it can't be used
+func CheckName(world *World, player *Player, name string) error {
+	if len(name) == 0 || len(name) > MaxNameLen {
+		return fmt.Errorf("name must be 1 to %d characters long", MaxNameLen)
+	}
+	if strings.TrimSpace(name) != name {
+		return errors.New("name can't start or end with a space")
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ' ' || c == '-' || c == '_') {
+			return errors.New("name can only contain letters, numbers, spaces, '-' and '_'")
+		}
+	}
+	for i := range world.PlayerList {
+		other := &world.PlayerList[i]
+		if other.Id != player.Id && strings.EqualFold(other.Name, name) {
+			return errors.New("name is already taken")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package entity
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/mymath"
+)
+
+const (
+	navCellsPerTile  = 2   // nav nodes are placed every half tile so that players fitting exactly in a gap can path through it
+	navRadiusScale   = 0.9 // players can just touch walls without overlapping them
+	maxCachedFields  = 256 // flow fields kept per map before the cache is cleared
+	navSearchRings   = 2   // how far to search for a walkable node near a position
+	navLookaheadStep = 2   // nodes ahead on the path to steer towards
+)
+
+var navNeighbours = [8][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}, {-1, -1}, {-1, 1}, {1, -1}, {1, 1}}
+
+// Grid of nodes that a player could be centred on without overlapping a wall, built on first use
+type navGrid struct {
+	once     sync.Once
+	spacing  float64
+	rows     int
+	cols     int
+	walkable []bool
+
+	mutex  sync.Mutex
+	fields map[int][]float64 // distance of every node to a goal node, keyed by goal node
+}
+
+func (m *Map) nav() *navGrid {
+	m.navGrid.once.Do(func() {
+		m.navGrid.build(m)
+	})
+	return &m.navGrid
+}
+
+func (g *navGrid) build(m *Map) {
+	g.spacing = float64(conf.Shared.TileSize) / navCellsPerTile
+	numCols := 0
+	for r := range m.Rows {
+		numCols = mymath.MaxInt(numCols, len(m.Rows[r]))
+	}
+	g.rows = len(m.Rows)*navCellsPerTile + 1
+	g.cols = numCols*navCellsPerTile + 1
+	g.walkable = make([]bool, g.rows*g.cols)
+	g.fields = map[int][]float64{}
+
+	for r := 0; r < g.rows; r++ {
+		for c := 0; c < g.cols; c++ {
+			g.walkable[r*g.cols+c] = !overlapsWall(m, g.nodePos(r*g.cols+c), navRadiusScale*conf.Shared.PlayerRadius)
+		}
+	}
+}
+
+// Same overlap tests used to keep players out of walls
+func overlapsWall(m *Map, pos mymath.Vec, radius float64) bool {
+	tileSize := float64(conf.Shared.TileSize)
+	tileRect := mymath.Rect{Size: mymath.Vec{X: tileSize, Y: tileSize}}
+	circle := mymath.Circle{Pos: pos, Radius: radius}
+	for _, tile := range m.SampleTiles(pos, radius, PlayerCollisionGroup) {
+		var overlaps bool
+		if tile.Type == TileTypeWall {
+			tileRect.Pos = tile.Pos
+			overlaps, _ = mymath.CircleRectOverlap(circle, tileRect)
+		} else if tile.Type == TileTypeWallTriangle || tile.Type == TileTypeWallTriangleCorner {
+			t0, t1, t2 := tile.CalcTrianglePoints()
+			overlaps, _ = mymath.CircleTriangleOverlap(circle, t0, t1, t2)
+		}
+		if overlaps {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *navGrid) nodePos(node int) mymath.Vec {
+	return mymath.Vec{X: float64(node % g.cols), Y: float64(node / g.cols)}.Scale(g.spacing)
+}
+
+// Closest walkable node to a position, -1 if there isn't one nearby
+func (g *navGrid) nodeAt(pos mymath.Vec) int {
+	row := int(math.Round(pos.Y / g.spacing))
+	col := int(math.Round(pos.X / g.spacing))
+	best := -1
+	bestDist := 0.0
+	for r := row - navSearchRings; r <= row+navSearchRings; r++ {
+		for c := col - navSearchRings; c <= col+navSearchRings; c++ {
+			if r < 0 || r >= g.rows || c < 0 || c >= g.cols || !g.walkable[r*g.cols+c] {
+				continue
+			}
+			dist := g.nodePos(r*g.cols + c).DistanceTo(pos)
+			if best == -1 || dist < bestDist {
+				best = r*g.cols + c
+				bestDist = dist
+			}
+		}
+	}
+	return best
+}
+
+// Calls fn for each node that can be moved to directly from the node. Diagonal moves can't cut corners.
+func (g *navGrid) forNeighbours(node int, fn func(next int, cost float64)) {
+	row := node / g.cols
+	col := node % g.cols
+	for _, offset := range navNeighbours {
+		r := row + offset[0]
+		c := col + offset[1]
+		if r < 0 || r >= g.rows || c < 0 || c >= g.cols || !g.walkable[r*g.cols+c] {
+			continue
+		}
+		cost := g.spacing
+		if offset[0] != 0 && offset[1] != 0 {
+			if !g.walkable[row*g.cols+c] || !g.walkable[r*g.cols+col] {
+				continue
+			}
+			cost *= math.Sqrt2
+		}
+		fn(r*g.cols+c, cost)
+	}
+}
+
+// Distance of every node to the goal node (-1 if unreachable), computed once and then cached
+func (g *navGrid) field(goal int) []float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if field, ok := g.fields[goal]; ok {
+		return field
+	}
+	if len(g.fields) >= maxCachedFields {
+		g.fields = map[int][]float64{}
+	}
+
+	field := make([]float64, len(g.walkable))
+	for i := range field {
+		field[i] = -1
+	}
+	field[goal] = 0
+	queue := &navQueue{{node: goal}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(navItem)
+		if item.dist > field[item.node] {
+			continue // already found a shorter route
+		}
+		g.forNeighbours(item.node, func(next int, cost float64) {
+			dist := item.dist + cost
+			if field[next] == -1 || dist < field[next] {
+				field[next] = dist
+				heap.Push(queue, navItem{node: next, dist: dist})
+			}
+		})
+	}
+
+	g.fields[goal] = field
+	return field
+}
+
+// Next node on the shortest path to the goal of the field, -1 if there is no closer node
+func (g *navGrid) nextNode(field []float64, node int) int {
+	best := -1
+	bestDist := field[node]
+	g.forNeighbours(node, func(next int, cost float64) {
+		if field[next] != -1 && field[next] < bestDist {
+			best = next
+			bestDist = field[next]
+		}
+	})
+	return best
+}
+
+// Distance a player would have to travel between the positions, false if there is no path
+func (m *Map) PathDistance(from mymath.Vec, to mymath.Vec) (float64, bool) {
+	g := m.nav()
+	start, goal := g.nodeAt(from), g.nodeAt(to)
+	if start == -1 || goal == -1 {
+		return 0, false
+	}
+	dist := g.field(goal)[start]
+	return dist, dist != -1
+}
+
+// Direction to move in to follow the shortest path between the positions, false if there is no path
+func (m *Map) PathDirection(from mymath.Vec, to mymath.Vec) (mymath.Vec, bool) {
+	g := m.nav()
+	start, goal := g.nodeAt(from), g.nodeAt(to)
+	if start == -1 || goal == -1 {
+		return mymath.Vec{}, false
+	}
+	field := g.field(goal)
+	if field[start] == -1 {
+		return mymath.Vec{}, false
+	}
+
+	// Steer a few nodes ahead so that we don't zig-zag between neighbouring nodes
+	node := start
+	for i := 0; i < navLookaheadStep; i++ {
+		next := g.nextNode(field, node)
+		if next == -1 {
+			break
+		}
+		node = next
+	}
+	if node == goal {
+		return to.Sub(from), true
+	}
+	return g.nodePos(node).Sub(from), true
+}
+
+// Positions along the shortest path between the positions, ending at the destination. False if there is no path.
+func (m *Map) FindPath(from mymath.Vec, to mymath.Vec) ([]mymath.Vec, bool) {
+	g := m.nav()
+	start, goal := g.nodeAt(from), g.nodeAt(to)
+	if start == -1 || goal == -1 {
+		return nil, false
+	}
+	field := g.field(goal)
+	if field[start] == -1 {
+		return nil, false
+	}
+
+	var path []mymath.Vec
+	for node := g.nextNode(field, start); node != -1 && node != goal; node = g.nextNode(field, node) {
+		path = append(path, g.nodePos(node))
+	}
+	return append(path, to), true
+}
+
+type navItem struct {
+	node int
+	dist float64
+}
+
+// Min heap of nodes ordered by distance
+type navQueue []navItem
+
+func (q navQueue) Len() int            { return len(q) }
+func (q navQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q navQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *navQueue) Push(x interface{}) { *q = append(*q, x.(navItem)) }
+func (q *navQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -11,6 +11,7 @@ import (
 
 const (
 	PlayerNetStateJoining = iota
+	PlayerNetStateWaitingForName
 	PlayerNetStateWaitingForInput
 	PlayerNetStateReady
 )
@@ -26,8 +27,12 @@ const (
 	TeamRed
 	TeamBlue
 	TeamYellow
+	NumTeams
 )
 
+// Team of players in free-for-all, every other player is an enemy
+const TeamNone = -1
+
 const (
 	FlagCooldownTicks = 45
 )
@@ -46,6 +51,7 @@ type PlayerPredicted struct {
 
 type Player struct {
 	Id                  uint8
+	Name                string // empty until chosen by the player
 	Team                int
 	NetState            int
 	State               int
@@ -58,9 +64,20 @@ type Player struct {
 	LastInput           PlayerInput
 	DoDisconnect        bool
 	DoSpeedup           bool
+	SentJoinState       bool // map, roster, etc have been sent since joining
+	Spectator           bool // watching rather than playing, has no team
+	IsBot               bool // inputs are generated by the server, has no connection
+	FillBot             bool // bot added to make up Match.BotFill, rather than through the admin API
+	WantSpectator       bool // requested by the client, applied by the game loop
 	JailTimeTicks       int
 	FlagCooldownTicks   int
 	FlagIndex           int // -1 means no flag
+	MapVote             int // index of map vote candidate, -1 if not voted
+	Stats               PlayerStats
+	Attackers           []uint8 // ids of players that damaged us since we were last jailed, most recent last
+	Token               string  // secret the client can reconnect with after a server restart
+	ReconnectTicks      int     // time left for the client to reconnect after a server restart, 0 once connected
+	NameWaitTicks       int     // time spent waiting for the client to choose a name
 }
 
 type PlayerInput struct {
@@ -99,29 +116,37 @@ func (in PlayerInput) GetDirNum() int {
 	return dirMap[row][col]
 }
 
-func NewPlayer(id uint8, team int, client web.Client) Player {
-	acked := NewPlayerPredicted()
-	predicted := NewPlayerPredicted()
+// Team is ignored for spectators
+func NewPlayer(id uint8, team int, client web.Client, params conf.SharedParams) Player {
+	acked := NewPlayerPredicted(params)
+	predicted := NewPlayerPredicted(params)
+
+	if client.Spectate {
+		team = TeamNone
+	}
 
 	return Player{
 		Id:             id,
 		Team:           team,
+		Spectator:      client.Spectate,
+		WantSpectator:  client.Spectate,
 		NetState:       PlayerNetStateJoining,
 		State:          PlayerStateSpectating,
-		Health:         conf.Shared.PlayerHealth,
+		Health:         params.PlayerHealth,
 		Acked:          acked,
 		Predicted:      predicted,
 		Client:         client,
 		ReceivedInputs: make([]PlayerInput, 0, maxPredictedInputs),
 		FlagIndex:      -1,
+		MapVote:        -1,
 	}
 }
 
-func NewPlayerPredicted() PlayerPredicted {
+func NewPlayerPredicted(params conf.SharedParams) PlayerPredicted {
 	return PlayerPredicted{
 		mymath.Vec{},
-		conf.Shared.MaxLaserEnergy,
-		conf.Shared.MaxBouncyEnergy,
+		params.MaxLaserEnergy,
+		params.MaxBouncyEnergy,
 	}
 }
 
@@ -137,7 +162,8 @@ func UpdatePlayers(world *World) {
 
 		player.TicksSinceLastInput++ // increment once per tick, decrement for each input received
 
-		if player.Health <= 0 {
+		if player.Health <= 0 && !player.Spectator {
+			recordDeath(world, player)
 			SendToJail(world, player)
 		}
 
@@ -145,16 +171,10 @@ func UpdatePlayers(world *World) {
 			player.FlagCooldownTicks -= 1
 		}
 
-		if player.State == PlayerStateJailed {
+		if player.State == PlayerStateJailed && !player.Spectator {
 			player.JailTimeTicks -= 1
 			if player.JailTimeTicks <= 0 {
-				player.State = PlayerStateAlive
-				switch player.Team {
-				case TeamGreen:
-					player.Acked.Pos = world.Map.RandomLocation(world.Map.GreenSpawns)
-				case TeamRed:
-					player.Acked.Pos = world.Map.RandomLocation(world.Map.RedSpawns)
-				}
+				releaseFromJail(world, player)
 			}
 		}
 
@@ -163,19 +183,39 @@ func UpdatePlayers(world *World) {
 	}
 }
 
-func SendToJail(world *World, player *Player) {
-	switch player.Team {
-	case TeamGreen:
-		player.Acked.Pos = world.Map.RandomLocation(world.Map.GreenJails)
-	case TeamRed:
-		player.Acked.Pos = world.Map.RandomLocation(world.Map.RedJails)
+// Puts a player into play, spectators remain spectating
+func EnterGame(world *World, player *Player) {
+	if player.Spectator {
+		return
 	}
+	SendToJail(world, player)
+}
+
+// Takes a player out of play, any flag they were carrying is dropped on the next flag update
+func Spectate(world *World, player *Player) {
+	player.Spectator = true
+	player.Team = TeamNone
+	player.State = PlayerStateSpectating
+	player.Health = world.Params.PlayerHealth
+	player.JailTimeTicks = 0
+	player.Attackers = player.Attackers[:0]
+}
 
-	player.Health = conf.Shared.PlayerHealth
-	player.JailTimeTicks = conf.Shared.JailTimeTicks
+func SendToJail(world *World, player *Player) {
+	player.Acked.Pos = world.RandomLocation(world.Map.TeamJails(player.Team))
+
+	player.Health = world.Params.PlayerHealth
+	player.Attackers = player.Attackers[:0]
+	player.JailTimeTicks = world.Params.JailTimeTicks
 	player.State = PlayerStateJailed
 }
 
+func releaseFromJail(world *World, player *Player) {
+	player.State = PlayerStateAlive
+	player.JailTimeTicks = 0
+	player.Acked.Pos = world.RandomLocation(world.Map.TeamSpawns(player.Team))
+}
+
 func processReceivedInputs(world *World, player *Player) {
 	numReceivedInputs := len(player.ReceivedInputs)
 	if numReceivedInputs > player.TicksSinceLastInput {
@@ -187,7 +227,11 @@ func processReceivedInputs(world *World, player *Player) {
 	for _, input := range player.ReceivedInputs {
 		player.TicksSinceLastInput--
 
-		disp := calcDisplacement(input)
+		if player.State == PlayerStateSpectating {
+			continue // inputs are acked but spectators don't move or shoot, camera is controlled by the client
+		}
+
+		disp := calcDisplacement(input, world.Params.PlayerSpeed)
 		player.Acked.Pos = player.Acked.Pos.Add(disp)
 		player.Acked.Pos = constrainPlayerPos(world, player.Acked.Pos)
 
@@ -203,19 +247,19 @@ func processReceivedInputs(world *World, player *Player) {
 				Dir:   dir,
 				Angle: input.AimAngle,
 			}
-			if input.ShootPrimary && player.Acked.Energy >= conf.Shared.LaserEnergyCost {
-				player.Acked.Energy -= conf.Shared.LaserEnergyCost
+			if input.ShootPrimary && world.Params.LaserEnabled && player.Acked.Energy >= world.Params.LaserEnergyCost {
+				player.Acked.Energy -= world.Params.LaserEnergyCost
 				world.NewLasers = append(world.NewLasers, laser)
 			}
-			if input.ShootSecondary && player.Acked.BouncyEnergy >= conf.Shared.BouncyEnergyCost {
-				player.Acked.BouncyEnergy -= conf.Shared.BouncyEnergyCost
+			if input.ShootSecondary && player.Acked.BouncyEnergy >= world.Params.BouncyEnergyCost {
+				player.Acked.BouncyEnergy -= world.Params.BouncyEnergyCost
 				laser.Type = ProjTypeBouncy
 				world.NewLasers = append(world.NewLasers, laser)
 			}
 		}
 
-		player.Acked.Energy = mymath.MinInt(conf.Shared.MaxLaserEnergy, player.Acked.Energy+1)
-		player.Acked.BouncyEnergy = mymath.MinInt(conf.Shared.MaxBouncyEnergy, player.Acked.BouncyEnergy+1)
+		player.Acked.Energy = mymath.MinInt(world.Params.MaxLaserEnergy, player.Acked.Energy+1)
+		player.Acked.BouncyEnergy = mymath.MinInt(world.Params.MaxBouncyEnergy, player.Acked.BouncyEnergy+1)
 	}
 }
 
@@ -236,12 +280,12 @@ func processPredictedInputs(world *World, player *Player) {
 	for i := 0; i < player.TicksSinceLastInput; i++ {
 		var disp mymath.Vec
 		if i < maxMotionPredictions {
-			disp = calcDisplacement(player.LastInput)
+			disp = calcDisplacement(player.LastInput, world.Params.PlayerSpeed)
 			player.Predicted.Pos = player.Predicted.Pos.Add(disp)
 			player.Predicted.Pos = constrainPlayerPos(world, player.Predicted.Pos)
 		}
-		player.Predicted.Energy = mymath.MinInt(conf.Shared.MaxLaserEnergy, player.Predicted.Energy+1)
-		player.Predicted.BouncyEnergy = mymath.MinInt(conf.Shared.MaxBouncyEnergy, player.Predicted.BouncyEnergy+1)
+		player.Predicted.Energy = mymath.MinInt(world.Params.MaxLaserEnergy, player.Predicted.Energy+1)
+		player.Predicted.BouncyEnergy = mymath.MinInt(world.Params.MaxBouncyEnergy, player.Predicted.BouncyEnergy+1)
 	}
 }
 
@@ -249,7 +293,7 @@ func constrainPlayerPos(world *World, pos mymath.Vec) mymath.Vec {
 	// TODO: if pass in prev pos, can eliminate some collision checks
 	tileSample := world.Map.SampleTiles(pos, conf.Shared.PlayerRadius, PlayerCollisionGroup)
 	tileSize := float64(conf.Shared.TileSize)
-	tileRect := mymath.Rect{Size: mymath.Vec{tileSize, tileSize}}
+	tileRect := mymath.Rect{Size: mymath.Vec{X: tileSize, Y: tileSize}}
 	playerCircle := mymath.Circle{Radius: conf.Shared.PlayerRadius}
 	for _, tile := range tileSample {
 		playerCircle.Pos = pos
@@ -271,7 +315,7 @@ func constrainPlayerPos(world *World, pos mymath.Vec) mymath.Vec {
 	return pos
 }
 
-func calcDisplacement(input PlayerInput) mymath.Vec {
+func calcDisplacement(input PlayerInput, speed float64) mymath.Vec {
 	// TODO: does it feel better if movement always occurs in direction of last pressed key (even if two opposing keys pressed)
 	var dir mymath.Vec
 	if input.Left {
@@ -290,5 +334,5 @@ func calcDisplacement(input PlayerInput) mymath.Vec {
 	if len < 1e-6 {
 		return dir
 	}
-	return dir.Scale(conf.Shared.PlayerSpeed / len)
+	return dir.Scale(speed / len)
 }
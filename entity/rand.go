@@ -0,0 +1,32 @@
+package entity
+
+// Deterministic random number generator (splitmix64). Its state is a plain value so that it can be saved and
+// restored along with the rest of the world.
+type Rand struct {
+	State uint64
+}
+
+func NewRand(seed int64) Rand {
+	return Rand{State: uint64(seed)}
+}
+
+func (r *Rand) Uint64() uint64 {
+	r.State += 0x9e3779b97f4a7c15
+	z := r.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Returns a number in [0, n), n must be greater than 0
+func (r *Rand) Intn(n int) int {
+	if n <= 0 {
+		panic("Rand.Intn: n must be greater than 0")
+	}
+	return int(r.Uint64() % uint64(n))
+}
+
+// Returns a number in [0, 1)
+func (r *Rand) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
@@ -0,0 +1,30 @@
+package entity
+
+// World state that can be saved to disk, so that play can carry on after a server restart. The map is saved by name
+// and connections aren't saved at all.
+type WorldSnapshot struct {
+	World         World
+	MapName       string
+	FreePlayerIds []uint8
+	PlayerIdCount int
+}
+
+func (w *World) Snapshot() WorldSnapshot {
+	world := *w
+	world.Map = nil
+	return WorldSnapshot{
+		World:         world,
+		MapName:       w.Map.Name,
+		FreePlayerIds: w.freePlayerIds,
+		PlayerIdCount: w.playerIdCount,
+	}
+}
+
+// Players are restored without connections
+func RestoreWorld(snapshot WorldSnapshot, gameMap *Map) World {
+	world := snapshot.World
+	world.Map = gameMap
+	world.freePlayerIds = snapshot.FreePlayerIds
+	world.playerIdCount = snapshot.PlayerIdCount
+	return world
+}
@@ -0,0 +1,89 @@
+package entity
+
+type PlayerStats struct {
+	Kills    int
+	Deaths   int
+	Assists  int
+	Captures int
+	Returns  int
+
+	RoundKills int // kills since the start of the round
+	RoundWins  int // only used in free-for-all, otherwise rounds are won by teams
+}
+
+type TeamStats struct {
+	Kills      int
+	Captures   int
+	RoundKills int // kills since the start of the round
+}
+
+// Returns true if the players are on different sides, players without a team are enemies of everyone
+func IsHostile(a *Player, b *Player) bool {
+	return a.Id != b.Id && (a.Team == TeamNone || a.Team != b.Team)
+}
+
+// Credits the killer and assisting attackers of a player that has just died
+func recordDeath(world *World, victim *Player) {
+	victim.Stats.Deaths++
+	world.ScoreboardChanged = true
+
+	if len(victim.Attackers) == 0 {
+		return
+	}
+
+	killerId := victim.Attackers[len(victim.Attackers)-1]
+	for i := range world.PlayerList {
+		player := &world.PlayerList[i]
+		if !IsHostile(player, victim) {
+			continue // no credit for team kills
+		}
+
+		for _, id := range victim.Attackers {
+			if id != player.Id {
+				continue
+			}
+			if id == killerId {
+				player.Stats.Kills++
+				player.Stats.RoundKills++
+				if player.Team != TeamNone {
+					world.TeamStats[player.Team].Kills++
+					world.TeamStats[player.Team].RoundKills++
+				}
+			} else {
+				player.Stats.Assists++
+			}
+			break
+		}
+	}
+}
+
+func recordCapture(world *World, player *Player) {
+	player.Stats.Captures++
+	if player.Team != TeamNone {
+		world.TeamStats[player.Team].Captures++
+	}
+	world.ScoreboardChanged = true
+}
+
+func recordReturn(world *World, player *Player) {
+	player.Stats.Returns++
+	world.ScoreboardChanged = true
+}
+
+func ResetRoundStats(world *World) {
+	for i := range world.PlayerList {
+		world.PlayerList[i].Stats.RoundKills = 0
+	}
+	for team := range world.TeamStats {
+		world.TeamStats[team].RoundKills = 0
+	}
+}
+
+// Clears all stats, e.g. when a new match begins
+func ResetStats(world *World) {
+	for i := range world.PlayerList {
+		world.PlayerList[i].Stats = PlayerStats{}
+	}
+	world.TeamStats = [NumTeams]TeamStats{}
+	world.ScoreboardChanged = true
+}
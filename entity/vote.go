@@ -0,0 +1,20 @@
+package entity
+
+// Players vote for the next map while a match is over
+type MapVote struct {
+	Active     bool
+	Candidates []string // names of candidate maps
+	Changed    bool     // clients need to be sent the latest vote
+}
+
+// Number of votes for each candidate
+func (w *World) MapVoteCounts() []int {
+	counts := make([]int, len(w.MapVote.Candidates))
+	for i := range w.PlayerList {
+		vote := w.PlayerList[i].MapVote
+		if vote >= 0 && vote < len(counts) {
+			counts[vote]++
+		}
+	}
+	return counts
+}
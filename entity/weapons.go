@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"math"
+
 	"github.com/kjander0/ctf/conf"
 	"github.com/kjander0/ctf/logger"
 	"github.com/kjander0/ctf/mymath"
@@ -21,12 +23,12 @@ type Laser struct {
 	ActiveTicks int
 }
 
-func LaserSpeed(laserType uint8) float64 {
+func LaserSpeed(params *conf.SharedParams, laserType uint8) float64 {
 	switch laserType {
 	case ProjTypeLaser:
-		return conf.Shared.LaserSpeed
+		return params.LaserSpeed
 	case ProjTypeBouncy:
-		return conf.Shared.BouncySpeed
+		return params.BouncySpeed
 	}
 	logger.Panic("unsupported laser type")
 	return -1
@@ -41,7 +43,7 @@ func UpdateProjectiles(world *World) {
 	// Increment activeTicks count and remove old lasers
 	for i := len(world.LaserList) - 1; i >= 0; i-- {
 		world.LaserList[i].ActiveTicks += 1
-		if world.LaserList[i].ActiveTicks > conf.Shared.LaserTimeTicks {
+		if world.LaserList[i].ActiveTicks > world.Params.LaserTimeTicks {
 			world.LaserList[i] = world.LaserList[len(world.LaserList)-1]
 			world.LaserList = world.LaserList[:len(world.LaserList)-1]
 		}
@@ -50,7 +52,7 @@ func UpdateProjectiles(world *World) {
 	// Move lasers forward
 	for i := range world.LaserList {
 		laser := &world.LaserList[i]
-		speed := LaserSpeed(laser.Type)
+		speed := LaserSpeed(&world.Params, laser.Type)
 		dir := laser.Dir
 		laser.Line.Start = laser.Line.End
 		disp := speed
@@ -81,6 +83,7 @@ func processCollisions(world *World, laserIndex int) bool {
 
 		if player != nil {
 			player.Health -= 1
+			addAttacker(player, world.LaserList[laserIndex].PlayerId)
 			hitPos = playerHitPos
 			world.NewHits = append(world.NewHits, hitPos)
 			return true
@@ -92,8 +95,8 @@ func processCollisions(world *World, laserIndex int) bool {
 		bounce(&world.LaserList[laserIndex], hitPos, normal)
 
 		bounceCount++
-		if bounceCount > conf.Shared.MaxBounces {
-			logger.Errorf("Reached bounce count limit: %d", conf.Shared.MaxBounces)
+		if bounceCount > world.Params.MaxBounces {
+			logger.Errorf("Reached bounce count limit: %d", world.Params.MaxBounces)
 			return true // laser is stuck, remove laser
 		}
 	}
@@ -101,7 +104,7 @@ func processCollisions(world *World, laserIndex int) bool {
 
 func checkWallHit(world *World, line mymath.Line) (float64, mymath.Vec, mymath.Vec) {
 	tileSize := float64(conf.Shared.TileSize)
-	tileRect := mymath.Rect{Size: mymath.Vec{tileSize, tileSize}}
+	tileRect := mymath.Rect{Size: mymath.Vec{X: tileSize, Y: tileSize}}
 	lineLen := line.Length()
 	tileSample := world.Map.SampleTiles(line.End, lineLen, LaserCollisionGroup)
 	var hitPos, hitNormal mymath.Vec
@@ -140,15 +143,34 @@ func checkWallHit(world *World, line mymath.Line) (float64, mymath.Vec, mymath.V
 	return hitDist, hitPos, hitNormal
 }
 
+// Returns true if a laser could travel between the points without hitting a wall
+func LineOfSight(world *World, from mymath.Vec, to mymath.Vec) bool {
+	// Check a tile length at a time so that only nearby tiles are sampled
+	step := float64(conf.Shared.TileSize)
+	dist := from.DistanceTo(to)
+	dir := to.Sub(from)
+	for travelled := 0.0; travelled < dist; travelled += step {
+		end := math.Min(travelled+step, dist)
+		segment := mymath.Line{
+			Start: from.Add(dir.Scale(travelled / dist)),
+			End:   from.Add(dir.Scale(end / dist)),
+		}
+		if hitDist, _, _ := checkWallHit(world, segment); hitDist != -1 {
+			return false
+		}
+	}
+	return true
+}
+
 func checkPlayerHit(world *World, laser *Laser, hitDist float64) (*Player, mymath.Vec) {
 	var hitPos mymath.Vec
 	var player *Player
 	for i := range world.PlayerList {
-		if world.PlayerList[i].Id == laser.PlayerId {
-			continue
+		if world.PlayerList[i].Id == laser.PlayerId || world.PlayerList[i].Spectator {
+			continue // spectators aren't drawn, they are left wherever they were when they stopped playing
 		}
 		// TODO: consider testing collisions using predicted position
-		playerCircle := mymath.Circle{world.PlayerList[i].Acked.Pos, conf.Shared.PlayerRadius}
+		playerCircle := mymath.Circle{Pos: world.PlayerList[i].Acked.Pos, Radius: conf.Shared.PlayerRadius}
 		intersected, hit := mymath.LaserCircleIntersect(laser.Line, playerCircle)
 		if !intersected {
 			continue
@@ -163,6 +185,30 @@ func checkPlayerHit(world *World, laser *Laser, hitDist float64) (*Player, mymat
 	return player, hitPos
 }
 
+// Keeps attackers in order of most recent hit
+func addAttacker(player *Player, attackerId uint8) {
+	for i, id := range player.Attackers {
+		if id == attackerId {
+			player.Attackers = append(player.Attackers[:i], player.Attackers[i+1:]...)
+			break
+		}
+	}
+	player.Attackers = append(player.Attackers, attackerId)
+}
+
+// Forgets a player that has left, so that their id isn't credited with assists once it is reused
+func ForgetAttacker(world *World, attackerId uint8) {
+	for i := range world.PlayerList {
+		player := &world.PlayerList[i]
+		for j, id := range player.Attackers {
+			if id == attackerId {
+				player.Attackers = append(player.Attackers[:j], player.Attackers[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
 func bounce(laser *Laser, hitPos mymath.Vec, normal mymath.Vec) {
 	incident := laser.Line.End.Sub(laser.Line.Start)
 	laser.Dir = incident.Reflect(normal).Normalize()
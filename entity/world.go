@@ -1,28 +1,52 @@
 package entity
 
-import "github.com/kjander0/ctf/mymath"
+import (
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/mymath"
+)
 
 type World struct {
-	Tick             uint8
-	Map              *Map
-	PlayerList       []Player
-	LaserList        []Laser
-	NewLasers        []Laser
-	NewHits          []mymath.Vec
-	freePlayerIds    []uint8
-	playerIdCount    int
-	FlagList         []Flag
-	WinningTeam      int
-	WinCooldownTicks int
+	ModeId            int               // game mode being played, for clients
+	Seed              int64             // the world can be reproduced from its seed and the inputs applied to it
+	Rand              Rand              // all randomness in the simulation must come from here
+	Params            conf.SharedParams // may be tuned while the game is running
+	Preset            string            // name of the rule preset the params came from, for clients
+	Rules             conf.MatchParams  // may differ from conf.Match while a map with overrides is played
+	Tick              uint8
+	Map               *Map
+	PlayerList        []Player
+	LaserList         []Laser
+	NewLasers         []Laser
+	NewHits           []mymath.Vec
+	NewJailbreaks     []Jailbreak
+	freePlayerIds     []uint8
+	playerIdCount     int
+	FlagList          []Flag
+	Hills             []Hill // indexed the same as Map.Hills
+	Match             Match
+	MapVote           MapVote
+	MapChanged        bool // clients need to be sent the new map
+	TeamStats         [NumTeams]TeamStats
+	ScoreboardChanged bool // clients need to be sent the latest stats
+	RosterChanged     bool // clients need to be sent the latest player names
+	ParamsChanged     bool // clients need to be sent the new params
 }
 
-func NewWorld(gameMap *Map) World {
+func NewWorld(gameMap *Map, seed int64) World {
 	return World{
-		Map:         gameMap,
-		WinningTeam: -1,
+		Seed:   seed,
+		Rand:   NewRand(seed),
+		Params: conf.Shared,
+		Rules:  conf.Match,
+		Map:    gameMap,
+		Match:  NewMatch(conf.Match),
 	}
 }
 
+func (w *World) RandomLocation(locations []mymath.Vec) mymath.Vec {
+	return locations[w.Rand.Intn(len(locations))]
+}
+
 func (w *World) NextPlayerId() (bool, uint8) {
 	if w.playerIdCount < 256 {
 		id := uint8(w.playerIdCount)
@@ -42,3 +66,13 @@ func (w *World) NextPlayerId() (bool, uint8) {
 func (w *World) FreePlayerId(id uint8) {
 	w.freePlayerIds = append(w.freePlayerIds, id)
 }
+
+// Returns nil if there is no player with the id
+func (w *World) FindPlayer(id uint8) *Player {
+	for i := range w.PlayerList {
+		if w.PlayerList[i].Id == id {
+			return &w.PlayerList[i]
+		}
+	}
+	return nil
+}
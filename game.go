@@ -1,118 +1,354 @@
 package main
 
 import (
-	"math/rand"
+	"fmt"
+	"path/filepath"
+	"time"
 
+	"github.com/kjander0/ctf/bot"
 	"github.com/kjander0/ctf/conf"
 	"github.com/kjander0/ctf/entity"
 	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mode"
+	"github.com/kjander0/ctf/mymath"
 	"github.com/kjander0/ctf/net"
+	"github.com/kjander0/ctf/replay"
+	"github.com/kjander0/ctf/sim"
 	"github.com/kjander0/ctf/web"
 )
 
+const (
+	roomIdleSecs = 30 // room is closed after being empty this long
+	inboxSize    = 64 // messages from a client waiting to be read by the game
+)
+
 type Game struct {
-	ClientC chan web.Client
-	World   entity.World
+	Room     string
+	ClientC  chan web.Client
+	StopC    chan string // directory to save a snapshot of the game to before stopping
+	AdminC   chan adminRequest
+	World    entity.World
+	Mode     mode.GameMode
+	rotation MapRotation
+	bots     bot.Controller
+	voteMaps []*entity.Map // candidates of the current map vote
+	maps     []*entity.Map
+	ticks    uint32 // ticks since the room opened, unlike World.Tick this doesn't wrap
+	nextConn uint32
+	inboxes  map[uint8]*inbox // keyed by player id
+	recorder *replay.Recorder // nil if not recording
+	capture  *net.Capture     // nil if not capturing
+	dropped  []uint32         // connections that must be dropped this tick, when playing back a replay
+
+	preset        conf.Preset  // rules the params came from, before any tuning
+	nextPreset    *conf.Preset // switched to when the next match starts, nil to keep the current preset
+	paramsHistory []ParamsChange
+}
+
+// Messages from a client are passed on to the game through an inbox, so that they can be recorded in the order the
+// game reads them
+type inbox struct {
+	conn   uint32
+	source chan []byte // the client's own read channel
+	closed bool
 }
 
-func NewGame(clientC chan web.Client, gameMap *entity.Map) Game {
-	return Game{
-		ClientC: clientC,
-		World:   entity.NewWorld(gameMap),
+func NewGame(room string, maps []*entity.Map, gameMode mode.GameMode, preset conf.Preset, seed int64) Game {
+	rotation := NewMapRotation(maps, conf.Match.MapShuffle, seed)
+	world := entity.NewWorld(rotation.Next(), seed)
+	world.ModeId = gameMode.Id()
+	params, rules, err := gameRules(preset, world.Map)
+	if err != nil {
+		// Presets and maps are checked when they are loaded
+		logger.Panicf("NewGame: preset '%s' on map '%s': %v", preset.Name, world.Map.Name, err)
+	}
+	world.Params = params
+	world.Rules = rules
+	world.Match = entity.NewMatch(rules)
+	world.Preset = preset.Name
+	game := Game{
+		Room:     room,
+		ClientC:  make(chan web.Client, 10),
+		StopC:    make(chan string, 1),
+		AdminC:   make(chan adminRequest, 10),
+		World:    world,
+		Mode:     gameMode,
+		rotation: rotation,
+		bots:     bot.NewController(),
+		maps:     maps,
+		inboxes:  map[uint8]*inbox{},
+		preset:   preset,
+	}
+	game.roundReset()
+	return game
+}
+
+// Records everything needed to replay the room to a file in the directory, call before running the game
+func (g *Game) Record(dir string) {
+	header := replay.Header{
+		Room:   g.Room,
+		Mode:   g.Mode.Name(),
+		Seed:   g.World.Seed,
+		Shared: conf.Shared,
+		Match:  conf.Match,
+		Preset: g.preset,
+	}
+	for _, m := range g.maps {
+		header.Maps = append(header.Maps, replay.MapFile{Name: m.Name, Data: m.Data})
+	}
+
+	filename := filepath.Join(dir, fmt.Sprintf("%s-%s.replay", g.Room, time.Now().Format("20060102-150405")))
+	recorder, err := replay.NewRecorder(filename, header)
+	if err != nil {
+		logger.Errorf("room '%s': not recording: %v", g.Room, err)
+		return
 	}
+	g.recorder = recorder
+	logger.Infof("room '%s': recording to %s", g.Room, filename)
 }
 
+// Runs the game loop until the room has been empty for roomIdleSecs, or until told to stop
 func (g *Game) Run() {
 	ticker := NewTicker(float64(conf.Shared.TickRate))
 	ticker.Start()
 
-	g.roundReset()
-
+	idleTicks := 0
+loop:
 	for {
 		// TODO: probs wanna accept more than 1 client per tick?
 		select {
-		case newClient := <-g.ClientC:
-			ok, id := g.World.NextPlayerId()
-			if !ok {
-				logger.Debug("server full, rejecting connection")
-				close(newClient.WriteC)
+		case dir := <-g.StopC:
+			if err := g.SaveSnapshot(dir); err != nil {
+				logger.Errorf("room '%s': failed to save snapshot: %v", g.Room, err)
 			}
-			team := findNextTeam(&g.World)
-			g.World.PlayerList = append(g.World.PlayerList, entity.NewPlayer(id, team, newClient))
+			break loop
+		case newClient := <-g.ClientC:
+			g.addClient(newClient)
 		default:
 		}
+		g.serveAdmin()
 
-		net.ReceiveMessages(&g.World)
-		entity.UpdatePlayers(&g.World)
-		entity.UpdateProjectiles(&g.World)
-		entity.UpdateFlags(&g.World)
-		net.SendMessages(&g.World)
-		removeDisconnectedPlayers(&g.World)
-
-		if g.World.WinCooldownTicks > 0 {
-			g.World.WinCooldownTicks--
-		}
-
-		if g.World.WinningTeam != -1 && g.World.WinCooldownTicks == 0 {
-			g.roundReset()
+		if len(g.World.PlayerList) == 0 {
+			idleTicks++
+			if idleTicks >= roomIdleSecs*conf.Shared.TickRate {
+				break loop
+			}
+		} else {
+			idleTicks = 0
 		}
 
-		g.World.Tick += 1
+		g.update()
 
 		ticker.Sleep()
 	}
+
+	if g.recorder != nil {
+		g.recorder.End(g.ticks)
+	}
 }
 
-func (g *Game) roundReset() {
-	g.World.WinningTeam = -1
+func (g *Game) addClient(client web.Client) {
+	conn := g.nextConn
+	g.nextConn++
+	if g.recorder != nil {
+		g.recorder.Join(g.ticks, conn, client.Spectate)
+	}
 
-	// Reset flags
-	g.World.FlagList = []entity.Flag{}
-	for _, pos := range g.World.Map.FlagSpawns {
-		g.World.FlagList = append(g.World.FlagList, entity.NewFlag(pos))
+	if client.Token != "" && g.reconnect(client, conn) {
+		return
+	}
+
+	ok, id := g.World.NextPlayerId()
+	if !ok {
+		logger.Debug("server full, rejecting connection")
+		close(client.WriteC)
+		return
+	}
+	g.inboxes[id] = &inbox{conn: conn, source: client.ReadC}
+	client.ReadC = make(chan []byte, inboxSize)
+
+	team := g.Mode.AssignTeam(&g.World) // ignored if spectating
+	player := entity.NewPlayer(id, team, client, g.World.Params)
+	player.Token = newToken()
+	g.World.PlayerList = append(g.World.PlayerList, player)
+	g.World.ScoreboardChanged = true
+}
+
+// Advances the room by one tick
+func (g *Game) update() {
+	g.deliverMessages()
+	net.ReceiveMessages(&g.World)
+	g.updateSpectators()
+	g.fillBots()
+	g.bots.Update(&g.World)
+	sim.Step(&g.World, g.Mode)
+	net.SendMessages(&g.World, g.capture)
+	g.expireReconnects()
+	g.removeDisconnectedPlayers()
+	g.updateMatch()
+
+	g.World.Tick += 1
+	g.ticks++
+	if g.recorder != nil && g.ticks%uint32(conf.Shared.TickRate) == 0 {
+		g.recorder.Flush()
+	}
+}
+
+// Moves messages that have arrived from clients into their inboxes
+func (g *Game) deliverMessages() {
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		box, ok := g.inboxes[player.Id]
+		if !ok || box.closed {
+			continue
+		}
+
+	deliver:
+		for len(player.Client.ReadC) < cap(player.Client.ReadC) {
+			select {
+			case msg, ok := <-box.source:
+				if !ok {
+					box.closed = true
+					close(player.Client.ReadC)
+					if g.recorder != nil {
+						g.recorder.Disconnect(g.ticks, box.conn)
+					}
+					break deliver
+				}
+				player.Client.ReadC <- msg
+				if g.recorder != nil {
+					g.recorder.Message(g.ticks, box.conn, msg)
+				}
+			default:
+				break deliver
+			}
+		}
 	}
+}
+
+func (g *Game) roundReset() {
+	g.World.FlagList = []entity.Flag{}
+	g.World.Hills = nil
+	entity.ResetRoundStats(&g.World)
+	g.Mode.RoundSetup(&g.World)
 
 	// Reset players
 	for i := range g.World.PlayerList {
 		player := &g.World.PlayerList[i]
-		entity.SendToJail(&g.World, player)
+		if player.NetState == entity.PlayerNetStateReady {
+			entity.EnterGame(&g.World, player)
+		}
 	}
 
 	g.World.LaserList = []entity.Laser{}
 }
 
-func findNextTeam(world *entity.World) int {
-	greenCount := 0
-	redCount := 0
-	for i := range world.PlayerList {
-		switch world.PlayerList[i].Team {
-		case entity.TeamGreen:
-			greenCount += 1
-		case entity.TeamRed:
-			redCount += 1
+// Switches to a new map, players are moved to teams that exist on that map
+func (g *Game) changeMap(gameMap *entity.Map) {
+	logger.Infof("room '%s': changing map to '%s'", g.Room, gameMap.Name)
+	g.World.Map = gameMap
+	g.World.MapChanged = true
+	g.applyMapOverrides()
+
+	validTeams := map[int]bool{}
+	for _, team := range gameMap.Teams() {
+		validTeams[team] = true
+	}
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		if player.Team != entity.TeamNone && !validTeams[player.Team] {
+			player.Team = g.Mode.AssignTeam(&g.World)
+			g.World.ScoreboardChanged = true
 		}
 	}
-	if greenCount > redCount {
-		return entity.TeamGreen
-	} else if redCount > greenCount {
-		return entity.TeamGreen
-	} else {
-		if rand.Intn(2) == 0 {
-			return entity.TeamGreen
+
+	g.roundReset()
+}
+
+// Adds a bot to the team with the fewest players, returns false if the room is full. The bot stays until removed, on
+// top of any fill bots.
+func (g *Game) AddBot() bool {
+	return g.bots.Add(&g.World, g.Mode.AssignTeam(&g.World), false)
+}
+
+// Removes a bot added by AddBot, or a fill bot if there are none, returns false if there are no bots
+func (g *Game) RemoveBot() bool {
+	return g.bots.Remove(&g.World, false) || g.bots.Remove(&g.World, true)
+}
+
+// Keeps the number of players at g.World.Rules.BotFill using fill bots, they leave when there are no people left to play
+// with. Bots added by AddBot are left alone.
+func (g *Game) fillBots() {
+	numPeople := 0
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		if !player.IsBot && !player.Spectator {
+			numPeople++
+		}
+	}
+
+	want := 0
+	if numPeople > 0 {
+		want = mymath.MaxInt(0, g.World.Rules.BotFill-numPeople)
+	}
+	numFill := g.bots.Count(&g.World, true)
+	if numFill < want {
+		g.bots.Add(&g.World, g.Mode.AssignTeam(&g.World), true)
+	} else if numFill > want {
+		g.bots.Remove(&g.World, true)
+	}
+}
+
+// Moves players between playing and spectating as they have requested
+func (g *Game) updateSpectators() {
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		if player.WantSpectator == player.Spectator || player.NetState != entity.PlayerNetStateReady {
+			continue
+		}
+
+		if player.WantSpectator {
+			entity.Spectate(&g.World, player)
+			logger.Infof("room '%s': '%s' is now spectating", g.Room, player.Client.Username)
 		} else {
-			return entity.TeamRed
+			player.Team = g.Mode.AssignTeam(&g.World) // spectators have no team so aren't counted
+			player.Spectator = false
+			entity.SendToJail(&g.World, player)
+			logger.Infof("room '%s': '%s' joined team %d", g.Room, player.Client.Username, player.Team)
 		}
+		g.World.ScoreboardChanged = true
 	}
 }
 
-func removeDisconnectedPlayers(world *entity.World) {
+func (g *Game) removeDisconnectedPlayers() {
+	world := &g.World
+	for _, conn := range g.dropped {
+		for i := range world.PlayerList {
+			if box, ok := g.inboxes[world.PlayerList[i].Id]; ok && box.conn == conn {
+				world.PlayerList[i].DoDisconnect = true
+			}
+		}
+	}
+	g.dropped = g.dropped[:0]
+
 	for i := len(world.PlayerList) - 1; i >= 0; i -= 1 { // loop backwards for removing elements
 		if world.PlayerList[i].DoDisconnect {
 			logger.Infof("'%s' disconnected, remaining players: %d", world.PlayerList[i].Client.Username, len(world.PlayerList)-1)
-			close(world.PlayerList[i].Client.WriteC)
+			if world.PlayerList[i].Client.WriteC != nil { // bots and players yet to reconnect have no connection
+				close(world.PlayerList[i].Client.WriteC)
+			}
+			if box, ok := g.inboxes[world.PlayerList[i].Id]; ok {
+				if g.recorder != nil {
+					g.recorder.Leave(g.ticks, box.conn)
+				}
+				delete(g.inboxes, world.PlayerList[i].Id)
+			}
+			entity.ForgetAttacker(world, world.PlayerList[i].Id)
 			world.FreePlayerId(world.PlayerList[i].Id)
 			world.PlayerList[i] = world.PlayerList[len(world.PlayerList)-1]
 			world.PlayerList = world.PlayerList[0 : len(world.PlayerList)-1]
+			world.ScoreboardChanged = true
+			world.RosterChanged = true
 		}
 	}
 }
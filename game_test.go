@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/mode"
+	"github.com/kjander0/ctf/sim"
+	"github.com/kjander0/ctf/web"
+)
+
+var testRows = []string{
+	"############",
+	"#G........R#",
+	"#..........#",
+	"#.1....F...#",
+	"#g...#....r#",
+	"#....#.....#",
+	"#..........#",
+	"############",
+}
+
+func newTestGame(t *testing.T) *Game {
+	t.Helper()
+	gameMode, err := mode.New("ctf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := NewGame("test", []*entity.Map{sim.MapFromASCII("test", testRows)}, gameMode, conf.DefaultPreset, 1)
+	return &game
+}
+
+func countBots(world *entity.World) int {
+	count := 0
+	for i := range world.PlayerList {
+		if world.PlayerList[i].IsBot {
+			count++
+		}
+	}
+	return count
+}
+
+func TestAdminBotStays(t *testing.T) {
+	g := newTestGame(t)
+	if err := g.applyAdmin(AdminAction{Kind: AdminAddBot}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		g.update()
+	}
+	if count := countBots(&g.World); count != 1 {
+		t.Fatalf("room has %d bots after 10 ticks, want 1", count)
+	}
+
+	if err := g.applyAdmin(AdminAction{Kind: AdminRemoveBot}); err != nil {
+		t.Fatal(err)
+	}
+	g.update()
+	if count := countBots(&g.World); count != 0 {
+		t.Fatalf("room has %d bots after removing one, want 0", count)
+	}
+}
+
+func TestNamelessClientIsDisconnected(t *testing.T) {
+	g := newTestGame(t)
+	client := web.Client{
+		ReadC:  make(chan []byte, inboxSize),
+		WriteC: make(chan []byte, inboxSize),
+	}
+	g.addClient(client)
+	for i := 0; i < conf.SecsToTicks(61); i++ {
+		g.update()
+		discardMessages([]chan []byte{client.WriteC})
+	}
+	if len(g.World.PlayerList) != 0 {
+		t.Fatalf("room has %d players, want the nameless client gone", len(g.World.PlayerList))
+	}
+}
+
+func TestLeaverIsForgottenAsAttacker(t *testing.T) {
+	g := newTestGame(t)
+	for i := 0; i < 2; i++ {
+		if err := g.applyAdmin(AdminAction{Kind: AdminAddBot}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	victim, leaver := &g.World.PlayerList[0], g.World.PlayerList[1].Id
+	victim.Attackers = append(victim.Attackers, leaver)
+
+	if err := g.applyAdmin(AdminAction{Kind: AdminRemoveBot}); err != nil {
+		t.Fatal(err)
+	}
+	g.update()
+	if len(g.World.PlayerList) != 1 || len(g.World.PlayerList[0].Attackers) != 0 {
+		t.Fatalf("remaining player has attackers %v, want none", g.World.PlayerList[0].Attackers)
+	}
+}
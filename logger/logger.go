@@ -2,33 +2,80 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"log"
 )
 
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelError
+)
+
+var levelNames = map[string]int{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"error": LevelError,
+}
+
+// Messages below this level are dropped, panics are always logged
+var level = LevelDebug
+
+func ParseLevel(name string) (int, bool) {
+	l, ok := levelNames[name]
+	return l, ok
+}
+
+func SetLevel(l int) {
+	level = l
+}
+
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
 func Debug(items ...interface{}) {
+	if level > LevelDebug {
+		return
+	}
 	msg := "DEBUG: " + fmt.Sprint(items...)
 	log.Println(msg)
 }
 
 func Debugf(fmt string, items ...interface{}) {
+	if level > LevelDebug {
+		return
+	}
 	log.Printf("DEBUG: "+fmt, items...)
 }
 
 func Info(items ...interface{}) {
+	if level > LevelInfo {
+		return
+	}
 	msg := "INFO: " + fmt.Sprint(items...)
 	log.Println(msg)
 }
 
 func Infof(fmt string, items ...interface{}) {
+	if level > LevelInfo {
+		return
+	}
 	log.Printf("INFO: "+fmt, items...)
 }
 
 func Error(items ...interface{}) {
+	if level > LevelError {
+		return
+	}
 	msg := "ERROR: " + fmt.Sprint(items...)
 	log.Println(msg)
 }
 
 func Errorf(fmt string, items ...interface{}) {
+	if level > LevelError {
+		return
+	}
 	log.Printf("ERROR: "+fmt, items...)
 }
 
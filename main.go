@@ -1,9 +1,17 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
 	"github.com/kjander0/ctf/conf"
-	"github.com/kjander0/ctf/entity"
 	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/net"
 	"github.com/kjander0/ctf/web"
 )
 
@@ -83,11 +91,120 @@ import (
 // - models should have an inner skeleton with different coloured/styled armour (like mobile suits)
 // - global illumination by sampling previous rendered frame OR from surrounding walls/floors
 
+// Command line shortcuts for common settings
+var settingFlags = []struct {
+	name    string
+	setting string
+	usage   string
+}{
+	{"addr", "Network.Addr", "address to serve the game on, e.g. :8000"},
+	{"admin", "Network.AdminAddr", "address for the admin API to listen on, e.g. localhost:8001"},
+	{"admin-token", "Network.AdminToken", "token admin API requests must carry"},
+	{"www", "Paths.WWW", "directory of the web client"},
+	{"maps", "Paths.Maps", "directory to load maps from"},
+	{"presets", "Paths.Presets", "directory to load rule presets from"},
+	{"record", "Paths.Records", "directory to record a replay of every room to"},
+	{"snapshots", "Paths.Snapshots", "directory to save rooms to on shutdown and restore them from on startup"},
+	{"log-level", "Log.Level", "debug, info or error"},
+	{"log-file", "Log.File", "file to append the log to"},
+}
+
 func main() {
-	conf.WriteSharedParams("www/shared.json")
+	configFile := flag.String("config", os.Getenv("CTF_CONFIG"), "JSON config file, settings it leaves out keep their defaults")
+	writeConfig := flag.String("write-config", "", "write the resulting config to a file and exit")
+	replayFile := flag.String("replay", "", "replay file to play back instead of running the server")
+	watchFile := flag.String("watch", "", "replay file to stream to browsers instead of running the server")
+	var overrides conf.Overrides
+	flag.Var(&overrides, "set", "override a setting, e.g. -set Match.RoundsToWin=3 (may be repeated)")
+	flagValues := map[string]*string{}
+	for _, f := range settingFlags {
+		flagValues[f.name] = flag.String(f.name, "", f.usage+" (sets "+f.setting+")")
+	}
+	flag.Parse()
+
+	// Shortcuts are applied before -set, whatever order they were given in
+	visited := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+	var settings conf.Overrides
+	for _, f := range settingFlags {
+		if visited[f.name] {
+			settings = append(settings, f.setting+"="+*flagValues[f.name])
+		}
+	}
+	if err := conf.Load(*configFile, append(settings, overrides...)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *writeConfig != "" {
+		if err := conf.WriteConfig(*writeConfig); err != nil {
+			logger.Panic(err)
+		}
+		return
+	}
+	setUpLogging()
+
+	if *replayFile != "" {
+		if err := PlayReplay(*replayFile, nil, nil); err != nil {
+			logger.Panic(err)
+		}
+		return
+	}
+
+	sharedFile := filepath.Join(conf.Server.Paths.WWW, "shared.json")
 	webserver := web.NewWebServer()
-	gameMap := entity.LoadMap("www/assets/maps/test.bin")
-	game := NewGame(webserver.ClientC, gameMap)
-	go game.Run()
+	if *watchFile != "" {
+		capture := &net.Capture{}
+		if err := PlayReplay(*watchFile, capture, nil); err != nil {
+			logger.Panic(err)
+		}
+		conf.WriteSharedParams(sharedFile) // clients need the params the match was played with
+		theatre := NewTheatre(webserver.ClientC, capture)
+		go theatre.Run()
+	} else {
+		conf.WriteSharedParams(sharedFile)
+		maps := LoadMaps(conf.Server.Paths.Maps)
+		presets, err := conf.LoadPresets(conf.Server.Paths.Presets)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		roomManager := NewRoomManager(webserver.ClientC, maps, presets, conf.Server.Paths.Records)
+		if dir := conf.Server.Paths.Snapshots; dir != "" {
+			roomManager.RestoreRooms(dir)
+			go saveOnShutdown(&roomManager, dir)
+		}
+		if network := conf.Server.Network; network.AdminAddr != "" {
+			adminServer := NewAdminServer(network.AdminAddr, network.AdminToken, &roomManager)
+			go func() {
+				logger.Error(adminServer.Run())
+			}()
+		}
+		go roomManager.Run()
+	}
 	logger.Error(webserver.Run())
 }
+
+func setUpLogging() {
+	level, _ := logger.ParseLevel(conf.Server.Log.Level) // already validated
+	logger.SetLevel(level)
+	if conf.Server.Log.File == "" {
+		return
+	}
+	file, err := os.OpenFile(conf.Server.Log.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Panic("opening log file: ", err)
+	}
+	logger.SetOutput(io.MultiWriter(os.Stderr, file))
+}
+
+// Saves every room when the server is told to stop, so that they carry on once it is started again
+func saveOnShutdown(roomManager *RoomManager, dir string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	logger.Info("shutting down, saving rooms to ", dir)
+	roomManager.Shutdown(dir)
+	os.Exit(0)
+}
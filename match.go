@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mode"
+)
+
+// Advances the match state machine, should be called once per tick after the world has been updated
+func (g *Game) updateMatch() {
+	match := &g.World.Match
+	if match.PhaseTicks > 0 {
+		match.PhaseTicks--
+	}
+
+	numReady := countReadyPlayers(&g.World)
+	if numReady == 0 && match.Phase != entity.MatchPhaseWaiting {
+		logger.Infof("room '%s': all players left, match abandoned", g.Room)
+		g.resetMatch()
+		return
+	}
+
+	roundWinner := -1
+	if !match.Frozen() {
+		roundWinner = g.Mode.RoundWinner(&g.World)
+		if !g.Mode.FreeForAll() {
+			for _, team := range g.World.Map.Teams() {
+				match.Scores[team] = g.Mode.Score(&g.World, team)
+			}
+		}
+	}
+
+	switch match.Phase {
+	case entity.MatchPhaseWaiting:
+		if roundWinner != -1 {
+			g.roundReset()
+		}
+		if numReady >= g.World.Rules.MinPlayers {
+			g.startPhase(entity.MatchPhaseWarmup, g.World.Rules.WarmupSecs)
+		}
+	case entity.MatchPhaseWarmup:
+		if roundWinner != -1 {
+			g.roundReset()
+		}
+		if numReady < g.World.Rules.MinPlayers {
+			g.startPhase(entity.MatchPhaseWaiting, 0)
+		} else if match.PhaseTicks == 0 {
+			g.startRound()
+		}
+	case entity.MatchPhaseLive:
+		if roundWinner != -1 {
+			g.endRound(roundWinner)
+		} else if g.World.Rules.RoundTimeSecs > 0 && match.PhaseTicks == 0 {
+			if side, ok := mode.Leader(&g.World, g.Mode); ok {
+				g.endRound(side)
+			} else {
+				g.startPhase(entity.MatchPhaseOvertime, g.World.Rules.OvertimeSecs)
+			}
+		}
+	case entity.MatchPhaseOvertime:
+		// Sudden death, first side to take the lead wins
+		if roundWinner != -1 {
+			g.endRound(roundWinner)
+		} else if side, ok := mode.Leader(&g.World, g.Mode); ok {
+			g.endRound(side)
+		} else if g.World.Rules.OvertimeSecs > 0 && match.PhaseTicks == 0 {
+			g.endRound(-1)
+		}
+	case entity.MatchPhaseIntermission:
+		if match.PhaseTicks == 0 {
+			g.startRound()
+		}
+	case entity.MatchPhaseOver:
+		if match.PhaseTicks == 0 {
+			g.changeMap(g.endMapVote())
+			g.resetMatch()
+		}
+	}
+}
+
+func (g *Game) startPhase(phase int, durationSecs int) {
+	g.World.Match.Phase = phase
+	g.World.Match.PhaseTicks = conf.SecsToTicks(durationSecs)
+}
+
+func (g *Game) startRound() {
+	g.World.Match.Round++
+	g.roundReset()
+	g.startPhase(entity.MatchPhaseLive, g.World.Rules.RoundTimeSecs)
+	logger.Infof("room '%s': round %d started", g.Room, g.World.Match.Round)
+}
+
+// Starts the current round again from scratch
+func (g *Game) restartRound() {
+	g.roundReset()
+	if g.World.Match.Phase == entity.MatchPhaseLive || g.World.Match.Phase == entity.MatchPhaseOvertime {
+		g.startPhase(entity.MatchPhaseLive, g.World.Rules.RoundTimeSecs)
+	}
+}
+
+// Side is a team, or a player id in free-for-all. Side -1 means the round was a draw
+func (g *Game) endRound(side int) {
+	match := &g.World.Match
+	match.RoundWinner = side
+	logger.Infof("room '%s': round %d won by %s", g.Room, match.Round, g.sideName(side))
+	if side == -1 {
+		g.startPhase(entity.MatchPhaseIntermission, g.World.Rules.IntermissionSecs)
+		return
+	}
+
+	var roundWins int
+	if g.Mode.FreeForAll() {
+		if player := g.World.FindPlayer(uint8(side)); player != nil {
+			player.Stats.RoundWins++
+			roundWins = player.Stats.RoundWins
+			g.World.ScoreboardChanged = true
+		}
+	} else {
+		match.RoundWins[side]++
+		roundWins = match.RoundWins[side]
+	}
+
+	if roundWins >= g.World.Rules.RoundsToWin {
+		match.MatchWinner = side
+		logger.Infof("room '%s': match won by %s", g.Room, g.sideName(side))
+		g.startPhase(entity.MatchPhaseOver, g.World.Rules.MatchOverSecs)
+		g.startMapVote()
+		return
+	}
+	g.startPhase(entity.MatchPhaseIntermission, g.World.Rules.IntermissionSecs)
+}
+
+// For logging
+func (g *Game) sideName(side int) string {
+	if side == -1 {
+		return "nobody"
+	}
+	if g.Mode.FreeForAll() {
+		return fmt.Sprintf("player %d", side)
+	}
+	return fmt.Sprintf("team %d", side)
+}
+
+func (g *Game) resetMatch() {
+	if g.nextPreset != nil {
+		if err := g.applyPreset(*g.nextPreset); err != nil {
+			logger.Errorf("room '%s': preset '%s': %v", g.Room, g.nextPreset.Name, err)
+		}
+		g.nextPreset = nil
+	}
+	g.World.Match = entity.NewMatch(g.World.Rules)
+	g.World.MapVote = entity.MapVote{Changed: true}
+	entity.ResetStats(&g.World)
+	g.roundReset()
+}
+
+func countReadyPlayers(world *entity.World) int {
+	count := 0
+	for i := range world.PlayerList {
+		if world.PlayerList[i].NetState == entity.PlayerNetStateReady && !world.PlayerList[i].Spectator {
+			count++
+		}
+	}
+	return count
+}
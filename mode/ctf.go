@@ -0,0 +1,51 @@
+package mode
+
+import "github.com/kjander0/ctf/entity"
+
+// Capture the flag, a team wins the round by delivering every flag to their goals
+type CTF struct {
+	teamMode
+}
+
+func (m *CTF) Id() int {
+	return ModeIdCTF
+}
+
+func (m *CTF) Name() string {
+	return "ctf"
+}
+
+func (m *CTF) RoundSetup(world *entity.World) {
+	world.FlagList = []entity.Flag{}
+	for _, pos := range world.Map.FlagSpawns {
+		world.FlagList = append(world.FlagList, entity.NewFlag(pos))
+	}
+}
+
+func (m *CTF) Update(world *entity.World) {
+	entity.UpdateFlags(world)
+}
+
+func (m *CTF) RoundWinner(world *entity.World) int {
+	numFlags := len(world.FlagList)
+	if numFlags == 0 {
+		return -1 // map has no flags, round can only be decided by time
+	}
+	for _, team := range world.Map.Teams() {
+		if m.Score(world, team) == numFlags {
+			return team
+		}
+	}
+	return -1
+}
+
+// Number of flags delivered to the team's goals
+func (m *CTF) Score(world *entity.World, team int) int {
+	delivered := 0
+	for i := range world.FlagList {
+		if world.FlagList[i].Team == team {
+			delivered++
+		}
+	}
+	return delivered
+}
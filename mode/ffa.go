@@ -0,0 +1,60 @@
+package mode
+
+import "github.com/kjander0/ctf/entity"
+
+// Free-for-all, every player is their own side and the first to reach the frag limit wins the round
+type FFA struct{}
+
+func (m *FFA) Id() int {
+	return ModeIdFFA
+}
+
+func (m *FFA) Name() string {
+	return "ffa"
+}
+
+func (m *FFA) RoundSetup(world *entity.World) {
+}
+
+func (m *FFA) Update(world *entity.World) {
+}
+
+func (m *FFA) AssignTeam(world *entity.World) int {
+	return entity.TeamNone
+}
+
+func (m *FFA) FreeForAll() bool {
+	return true
+}
+
+// Ids of players in the game, excluding spectators
+func (m *FFA) Sides(world *entity.World) []int {
+	var ids []int
+	for i := range world.PlayerList {
+		if world.PlayerList[i].NetState == entity.PlayerNetStateReady && !world.PlayerList[i].Spectator {
+			ids = append(ids, int(world.PlayerList[i].Id))
+		}
+	}
+	return ids
+}
+
+func (m *FFA) RoundWinner(world *entity.World) int {
+	if world.Rules.FragLimit <= 0 {
+		return -1 // only time limited
+	}
+	for _, id := range m.Sides(world) {
+		if m.Score(world, id) >= world.Rules.FragLimit {
+			return id
+		}
+	}
+	return -1
+}
+
+// Kills this round
+func (m *FFA) Score(world *entity.World, id int) int {
+	player := world.FindPlayer(uint8(id))
+	if player == nil {
+		return 0
+	}
+	return player.Stats.RoundKills
+}
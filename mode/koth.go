@@ -0,0 +1,48 @@
+package mode
+
+import (
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+)
+
+// King of the hill, a team wins the round by controlling the map's capture zones for long enough
+type KOTH struct {
+	teamMode
+}
+
+func (m *KOTH) Id() int {
+	return ModeIdKOTH
+}
+
+func (m *KOTH) Name() string {
+	return "koth"
+}
+
+func (m *KOTH) RoundSetup(world *entity.World) {
+	world.Hills = make([]entity.Hill, len(world.Map.Hills))
+	for i := range world.Hills {
+		world.Hills[i] = entity.NewHill()
+	}
+}
+
+func (m *KOTH) Update(world *entity.World) {
+	entity.UpdateHills(world)
+}
+
+func (m *KOTH) RoundWinner(world *entity.World) int {
+	if world.Rules.HillControlSecs <= 0 {
+		return -1 // only time limited
+	}
+	target := conf.SecsToTicks(world.Rules.HillControlSecs)
+	for _, team := range world.Map.Teams() {
+		if m.Score(world, team) >= target {
+			return team
+		}
+	}
+	return -1
+}
+
+// Ticks of hill control
+func (m *KOTH) Score(world *entity.World, team int) int {
+	return world.HillControl(team)
+}
@@ -0,0 +1,111 @@
+package mode
+
+import (
+	"fmt"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+)
+
+// Ids sent to clients so they know which objectives to display
+const (
+	ModeIdCTF = iota
+	ModeIdKOTH
+	ModeIdTDM
+	ModeIdFFA
+)
+
+// Rules for how a round is played and won. The game loop calls into the mode so that new modes can be added
+// without changing the core tick loop.
+type GameMode interface {
+	Id() int
+	Name() string
+
+	// Resets objectives at the start of each round
+	RoundSetup(world *entity.World)
+
+	// Updates objectives, called once per tick while a round is being played
+	Update(world *entity.World)
+
+	// Team for a player that has just joined or stopped spectating
+	AssignTeam(world *entity.World) int
+
+	// True if players play for themselves, in which case sides are player ids rather than teams
+	FreeForAll() bool
+
+	// Sides that can currently win a round
+	Sides(world *entity.World) []int
+
+	// Returns the side that has won the round outright, -1 if there is no winner yet
+	RoundWinner(world *entity.World) int
+
+	// Current score of a side, used to decide the winner when the round runs out of time
+	Score(world *entity.World, side int) int
+}
+
+// Creates a game mode from its name, e.g. as requested by a client when opening a room
+func New(name string) (GameMode, error) {
+	switch name {
+	case "", "ctf":
+		return &CTF{}, nil
+	case "koth":
+		return &KOTH{}, nil
+	case "tdm":
+		return &TDM{}, nil
+	case "ffa":
+		return &FFA{}, nil
+	}
+	return nil, fmt.Errorf("unknown game mode: %s", name)
+}
+
+// Returns the side with the highest score, false if the highest score is tied
+func Leader(world *entity.World, gameMode GameMode) (int, bool) {
+	leader := -1
+	leaderScore := 0
+	tied := false
+	for _, side := range gameMode.Sides(world) {
+		score := gameMode.Score(world, side)
+		if leader == -1 || score > leaderScore {
+			leader = side
+			leaderScore = score
+			tied = false
+		} else if score == leaderScore {
+			tied = true
+		}
+	}
+	return leader, leader != -1 && !tied
+}
+
+// Common behaviour of modes played between teams
+type teamMode struct{}
+
+// Picks the team with the fewest players out of the teams the map defines
+func (m *teamMode) AssignTeam(world *entity.World) int {
+	var counts [entity.NumTeams]int
+	for i := range world.PlayerList {
+		if team := world.PlayerList[i].Team; team != entity.TeamNone {
+			counts[team] += 1
+		}
+	}
+
+	var smallest []int
+	for _, team := range world.Map.Teams() {
+		if len(smallest) == 0 || counts[team] < counts[smallest[0]] {
+			smallest = []int{team}
+		} else if counts[team] == counts[smallest[0]] {
+			smallest = append(smallest, team)
+		}
+	}
+	if len(smallest) == 0 {
+		logger.Panic("map has no teams")
+	}
+	return smallest[world.Rand.Intn(len(smallest))]
+}
+
+func (m *teamMode) FreeForAll() bool {
+	return false
+}
+
+func (m *teamMode) Sides(world *entity.World) []int {
+	return world.Map.Teams()
+}
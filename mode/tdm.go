@@ -0,0 +1,39 @@
+package mode
+
+import "github.com/kjander0/ctf/entity"
+
+// Team deathmatch, flags are ignored and the first team to reach the frag limit wins the round
+type TDM struct {
+	teamMode
+}
+
+func (m *TDM) Id() int {
+	return ModeIdTDM
+}
+
+func (m *TDM) Name() string {
+	return "tdm"
+}
+
+func (m *TDM) RoundSetup(world *entity.World) {
+}
+
+func (m *TDM) Update(world *entity.World) {
+}
+
+func (m *TDM) RoundWinner(world *entity.World) int {
+	if world.Rules.FragLimit <= 0 {
+		return -1 // only time limited
+	}
+	for _, team := range world.Map.Teams() {
+		if m.Score(world, team) >= world.Rules.FragLimit {
+			return team
+		}
+	}
+	return -1
+}
+
+// Kills this round
+func (m *TDM) Score(world *entity.World, team int) int {
+	return world.TeamStats[team].RoundKills
+}
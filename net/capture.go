@@ -0,0 +1,203 @@
+package net
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mymath"
+	"github.com/kjander0/ctf/web"
+)
+
+const (
+	minPlaybackSpeed = 0.25
+	maxPlaybackSpeed = 4
+)
+
+// Commands from a viewer
+const (
+	playbackPauseCmd uint8 = 0 // value is 1 to pause, 0 to resume
+	playbackSeekCmd  uint8 = 1 // value is the frame to jump to
+	playbackSpeedCmd uint8 = 2 // value is the speed in percent
+)
+
+// Messages an observer outside the world is sent each tick, so that a match can be watched again later
+type Capture struct {
+	Frames []Frame
+}
+
+// Messages for one tick, those other than the world update are nil unless they changed that tick
+type Frame struct {
+	Params     []byte
+	Map        []byte
+	MapVote    []byte
+	Scoreboard []byte
+	Roster     []byte
+	Update     []byte
+}
+
+func (c *Capture) add(world *entity.World, frame Frame) {
+	if len(c.Frames) == 0 {
+		// Nothing has changed yet, but watching has to start somewhere
+		frame.Params = prepareParamsMsg(world)
+		frame.Map = prepareMapMsg(world)
+		frame.MapVote = prepareMapVoteMsg(world)
+		frame.Scoreboard = prepareScoreboardMsg(world)
+		frame.Roster = prepareRosterMsg(world)
+	}
+	c.Frames = append(c.Frames, frame)
+}
+
+// Messages that bring an observer up to date with a frame, e.g. after seeking to it
+func (c *Capture) catchUp(index int) [][]byte {
+	var latest Frame
+	for i := index; i >= 0; i-- {
+		frame := &c.Frames[i]
+		if latest.Params == nil {
+			latest.Params = frame.Params
+		}
+		if latest.Map == nil {
+			latest.Map = frame.Map
+		}
+		if latest.MapVote == nil {
+			latest.MapVote = frame.MapVote
+		}
+		if latest.Scoreboard == nil {
+			latest.Scoreboard = frame.Scoreboard
+		}
+		if latest.Roster == nil {
+			latest.Roster = frame.Roster
+		}
+	}
+	return [][]byte{latest.Params, latest.Map, latest.Roster, latest.Scoreboard, latest.MapVote, c.Frames[index].Update}
+}
+
+// A client watching a capture at their own pace
+type Viewer struct {
+	Client  web.Client
+	capture *Capture
+	pos     float64 // frames played, fractional when playing slower than normal
+	next    int     // next frame to send
+	speed   float64
+	paused  bool
+	seeked  bool     // must be caught up before the next frame is sent
+	pending [][]byte // messages that didn't fit in the write channel yet
+}
+
+func NewViewer(client web.Client, capture *Capture) *Viewer {
+	return &Viewer{
+		Client:  client,
+		capture: capture,
+		speed:   1,
+		seeked:  true,
+	}
+}
+
+// Applies the viewer's commands then sends them the frames they are due. Returns false once they have disconnected.
+func (v *Viewer) Update() bool {
+	if !v.receiveCommands() {
+		close(v.Client.WriteC)
+		return false
+	}
+
+	numFrames := len(v.capture.Frames)
+	if !v.send() {
+		return true // wait for the client to catch up before moving on
+	}
+	if !v.paused {
+		v.pos = math.Min(v.pos+v.speed, float64(numFrames))
+	}
+
+	var msgs [][]byte
+	if v.seeked && v.next < numFrames {
+		msgs = append(msgs, v.capture.catchUp(v.next)...)
+		v.next++
+		v.seeked = false
+	}
+	for ; v.next < int(v.pos); v.next++ {
+		frame := &v.capture.Frames[v.next]
+		for _, msg := range [][]byte{frame.Params, frame.Map, frame.MapVote, frame.Scoreboard, frame.Roster, frame.Update} {
+			if msg != nil {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	v.pending = append(v.pending, msgs...)
+	v.pending = append(v.pending, preparePlaybackMsg(v.next, numFrames, v.paused, v.speed))
+	v.send()
+	return true
+}
+
+// Returns false if the client has disconnected or sent something bad
+func (v *Viewer) receiveCommands() bool {
+	for i := 0; i < maxReadsPerTick; i++ {
+		var msgBytes []byte
+		var readOk bool
+		select {
+		case msgBytes, readOk = <-v.Client.ReadC:
+			if !readOk {
+				return false
+			}
+		default:
+			return true
+		}
+
+		decoder := NewDecoder(msgBytes)
+		if decoder.ReadUint8() != playbackCtrlMsgType {
+			continue // the client still sends inputs as if it were spectating a live game
+		}
+		cmd := decoder.ReadUint8()
+		value := decoder.ReadInt32()
+		if decoder.Error != nil {
+			logger.Error("Viewer: decoder error: ", decoder.Error)
+			return false
+		}
+
+		switch cmd {
+		case playbackPauseCmd:
+			v.paused = value != 0
+		case playbackSeekCmd:
+			v.next = mymath.MaxInt(0, mymath.MinInt(int(value), len(v.capture.Frames)-1))
+			v.pos = float64(v.next)
+			v.seeked = true
+		case playbackSpeedCmd:
+			v.speed = math.Max(minPlaybackSpeed, math.Min(float64(value)/100, maxPlaybackSpeed))
+		default:
+			logger.Error("Viewer: bad playback command: ", cmd)
+			return false
+		}
+	}
+	return true
+}
+
+// Sends as many pending messages as the client can take, returns true if none are left
+func (v *Viewer) send() bool {
+	for len(v.pending) > 0 {
+		select {
+		case v.Client.WriteC <- v.pending[0]:
+			v.pending = v.pending[1:]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func preparePlaybackMsg(frame int, numFrames int, paused bool, speed float64) []byte {
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(playbackMsgType)
+	encoder.WriteInt32(int32(frame))
+	encoder.WriteInt32(int32(numFrames))
+	if paused {
+		encoder.WriteUint8(1)
+	} else {
+		encoder.WriteUint8(0)
+	}
+	encoder.WriteFloat64(speed)
+	if encoder.Error != nil {
+		logger.Panic("preparePlaybackMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
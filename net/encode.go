@@ -3,6 +3,8 @@ package net
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 
 	"github.com/kjander0/ctf/mymath"
 )
@@ -44,6 +46,19 @@ func (e *Encoder) WriteBytes(val []byte) {
 	e.Offset += len(val)
 }
 
+// Strings are prefixed with their length (max 255 bytes)
+func (e *Encoder) WriteString(val string) {
+	if e.Error != nil {
+		return
+	}
+	if len(val) > 255 {
+		e.Error = errors.New("string too long")
+		return
+	}
+	e.WriteUint8(uint8(len(val)))
+	e.WriteBytes([]byte(val))
+}
+
 func (e *Encoder) WriteUint16(val uint16) {
 	if e.Error != nil {
 		return
@@ -53,6 +68,15 @@ func (e *Encoder) WriteUint16(val uint16) {
 	e.Offset += 2
 }
 
+func (e *Encoder) WriteInt16(val int16) {
+	if e.Error != nil {
+		return
+	}
+
+	e.Error = binary.Write(e.Buf, binary.BigEndian, val)
+	e.Offset += 2
+}
+
 func (e *Encoder) WriteUint16At(val uint16, offset int) {
 	if e.Error != nil {
 		return
@@ -112,6 +136,17 @@ func (d *Decoder) ReadUint8() uint8 {
 	return val
 }
 
+func (d *Decoder) ReadString() string {
+	length := int(d.ReadUint8())
+	if d.Error != nil {
+		return ""
+	}
+
+	val := make([]byte, length)
+	_, d.Error = io.ReadFull(d.Buf, val)
+	return string(val)
+}
+
 func (d *Decoder) ReadFloat64() float64 {
 	if d.Error != nil {
 		return 0
@@ -2,9 +2,13 @@ package net
 
 import (
 	"bytes"
+	"encoding/json"
+	"math"
 
+	"github.com/kjander0/ctf/conf"
 	"github.com/kjander0/ctf/entity"
 	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mymath"
 )
 
 // IF player ticking too slow:
@@ -16,12 +20,24 @@ import (
 
 const (
 	maxReadsPerTick = 10
+	nameTimeoutSecs = 60 // clients that haven't chosen a name by then are disconnected, freeing their player slot
 )
 
 const (
-	inputMsgType       uint8 = 0
-	stateUpdateMsgType uint8 = 1
-	initMsgType        uint8 = 2
+	inputMsgType        uint8 = 0
+	stateUpdateMsgType  uint8 = 1
+	initMsgType         uint8 = 2
+	mapMsgType          uint8 = 3
+	mapVoteMsgType      uint8 = 4
+	castVoteMsgType     uint8 = 5
+	scoreboardMsgType   uint8 = 6
+	nameMsgType         uint8 = 7
+	nameRejectedMsgType uint8 = 8
+	rosterMsgType       uint8 = 9
+	spectateMsgType     uint8 = 10
+	playbackMsgType     uint8 = 11
+	playbackCtrlMsgType uint8 = 12
+	paramsMsgType       uint8 = 13
 )
 
 const (
@@ -42,7 +58,18 @@ const (
 
 func ReceiveMessages(world *entity.World) {
 	for i := range world.PlayerList {
-		processMessages(world, &world.PlayerList[i])
+		player := &world.PlayerList[i]
+		if player.IsBot || player.ReconnectTicks > 0 {
+			continue // no connection
+		}
+		processMessages(world, player)
+		if player.NetState == entity.PlayerNetStateWaitingForName {
+			player.NameWaitTicks++
+			if player.NameWaitTicks > conf.SecsToTicks(nameTimeoutSecs) {
+				logger.Info("client didn't choose a name in time, disconnecting")
+				player.DoDisconnect = true
+			}
+		}
 	}
 }
 
@@ -67,13 +94,33 @@ outer:
 
 		switch msgType {
 		case inputMsgType:
+			if player.NetState != entity.PlayerNetStateWaitingForInput && player.NetState != entity.PlayerNetStateReady {
+				continue // still joining, input is meaningless
+			}
 			processInputMsg(player, decoder)
 			if player.DoDisconnect {
 				return
 			}
 			if player.NetState == entity.PlayerNetStateWaitingForInput {
 				player.NetState = entity.PlayerNetStateReady
-				entity.SendToJail(world, player)
+				if player.State == entity.PlayerStateSpectating { // still in play if reconnecting after a restart
+					entity.EnterGame(world, player)
+				}
+			}
+		case castVoteMsgType:
+			processCastVoteMsg(world, player, decoder)
+			if player.DoDisconnect {
+				return
+			}
+		case nameMsgType:
+			processNameMsg(world, player, decoder)
+			if player.DoDisconnect {
+				return
+			}
+		case spectateMsgType:
+			processSpectateMsg(player, decoder)
+			if player.DoDisconnect {
+				return
 			}
 		default:
 			logger.Error("ReceiveInputs: bad msg type: ", msgType)
@@ -133,29 +180,144 @@ func processInputMsg(player *entity.Player, decoder Decoder) {
 	player.ReceivedInputs = append(player.ReceivedInputs, newInputState)
 }
 
-// Sends world state to all players
-func SendMessages(world *entity.World) {
+func processCastVoteMsg(world *entity.World, player *entity.Player, decoder Decoder) {
+	candidate := int(decoder.ReadUint8())
+	if decoder.Error != nil {
+		logger.Error("processCastVoteMsg: decoder error: ", decoder.Error)
+		player.DoDisconnect = true
+		return
+	}
+
+	if !world.MapVote.Active || candidate >= len(world.MapVote.Candidates) {
+		return // vote may have just ended, not worth disconnecting over
+	}
+	player.MapVote = candidate
+	world.MapVote.Changed = true
+}
+
+func processSpectateMsg(player *entity.Player, decoder Decoder) {
+	spectate := decoder.ReadUint8()
+	if decoder.Error != nil {
+		logger.Error("processSpectateMsg: decoder error: ", decoder.Error)
+		player.DoDisconnect = true
+		return
+	}
+	player.WantSpectator = spectate != 0
+}
+
+func processNameMsg(world *entity.World, player *entity.Player, decoder Decoder) {
+	name := decoder.ReadString()
+	if decoder.Error != nil {
+		logger.Error("processNameMsg: decoder error: ", decoder.Error)
+		player.DoDisconnect = true
+		return
+	}
+
+	if player.NetState != entity.PlayerNetStateWaitingForName {
+		return // name can only be chosen when joining
+	}
+
+	if err := entity.CheckName(world, player, name); err != nil {
+		sendMsg(player, prepareNameRejectedMsg(err.Error()))
+		return
+	}
+
+	logger.Infof("'%s' joined", name)
+	player.Name = name
+	player.Client.Username = name
+	player.NetState = entity.PlayerNetStateWaitingForInput
+	world.RosterChanged = true
+	world.ScoreboardChanged = true
+}
+
+// Sends world state to all players, and to the capture if not nil
+func SendMessages(world *entity.World, capture *Capture) {
 	// TODO: Encode snap shot of entities once. Store unacked snapshots for each entity. Send only delta between
 	// latest snapshot and last acked snapshot. Could delta per-byte and use bitflag to tell which bytes changed
+	var paramsMsg, mapMsg, mapVoteMsg, scoreboardMsg, rosterMsg []byte
+	if world.ParamsChanged {
+		paramsMsg = prepareParamsMsg(world)
+	}
+	if world.MapChanged {
+		mapMsg = prepareMapMsg(world)
+	}
+	if world.MapVote.Changed {
+		mapVoteMsg = prepareMapVoteMsg(world)
+	}
+	if world.ScoreboardChanged {
+		scoreboardMsg = prepareScoreboardMsg(world)
+	}
+	if world.RosterChanged {
+		rosterMsg = prepareRosterMsg(world)
+	}
+
 	for i := range world.PlayerList {
-		var msgBytes []byte
-		switch world.PlayerList[i].NetState {
+		player := &world.PlayerList[i]
+		if player.IsBot || player.ReconnectTicks > 0 {
+			continue // no connection
+		}
+		var msgList [][]byte
+		switch player.NetState {
 		case entity.PlayerNetStateJoining:
-			msgBytes = prepareInitMsg(world, i)
-			world.PlayerList[i].NetState = entity.PlayerNetStateWaitingForInput
-		case entity.PlayerNetStateWaitingForInput:
-			fallthrough
-		case entity.PlayerNetStateReady:
-			msgBytes = prepareWorldUpdate(world, i)
+			msgList = append(msgList, prepareInitMsg(world, i))
+			if player.Name == "" {
+				player.NetState = entity.PlayerNetStateWaitingForName
+			} else {
+				player.NetState = entity.PlayerNetStateWaitingForInput // reconnected after a restart
+			}
+		case entity.PlayerNetStateWaitingForName:
+			// nothing to send until player has a name
+		case entity.PlayerNetStateWaitingForInput, entity.PlayerNetStateReady:
+			if !player.SentJoinState {
+				// Catch the player up on everything that is otherwise only sent when it changes
+				msgList = append(msgList, prepareParamsMsg(world), prepareMapMsg(world), prepareRosterMsg(world),
+					prepareScoreboardMsg(world))
+				if world.MapVote.Active {
+					msgList = append(msgList, prepareMapVoteMsg(world))
+				}
+				player.SentJoinState = true
+			} else {
+				for _, msg := range [][]byte{paramsMsg, mapMsg, mapVoteMsg, scoreboardMsg, rosterMsg} {
+					if msg != nil {
+						msgList = append(msgList, msg)
+					}
+				}
+			}
+			msgList = append(msgList, prepareWorldUpdate(world, i))
 		}
-		select {
-		case world.PlayerList[i].Client.WriteC <- msgBytes:
-		default:
-			logger.Error("SendWorldUpdate: WriteC would block, disconnecting player")
-			world.PlayerList[i].DoDisconnect = true
-			continue
+		for _, msgBytes := range msgList {
+			sendMsg(player, msgBytes)
+			if player.DoDisconnect {
+				break
+			}
 		}
 	}
+
+	if capture != nil {
+		capture.add(world, Frame{
+			Params:     paramsMsg,
+			Map:        mapMsg,
+			MapVote:    mapVoteMsg,
+			Scoreboard: scoreboardMsg,
+			Roster:     rosterMsg,
+			Update:     prepareWorldUpdate(world, -1),
+		})
+	}
+
+	world.ParamsChanged = false
+	world.MapChanged = false
+	world.MapVote.Changed = false
+	world.ScoreboardChanged = false
+	world.RosterChanged = false
+}
+
+func sendMsg(player *entity.Player, msgBytes []byte) {
+	select {
+	case player.Client.WriteC <- msgBytes:
+	default:
+		logger.Error("sendMsg: WriteC would block, disconnecting player")
+		player.DoDisconnect = true
+	}
 }
 
 func prepareInitMsg(world *entity.World, playerIndex int) []byte {
@@ -163,16 +325,154 @@ func prepareInitMsg(world *entity.World, playerIndex int) []byte {
 	encoder := NewEncoder(&buf)
 	encoder.WriteUint8(initMsgType)
 	encoder.WriteUint8(world.PlayerList[playerIndex].Id)
+	encoder.WriteString(world.PlayerList[playerIndex].Token)
+	if world.PlayerList[playerIndex].Name == "" {
+		encoder.WriteUint8(1) // client must choose a name
+	} else {
+		encoder.WriteUint8(0)
+	}
 	if encoder.Error != nil {
 		logger.Panic("prepareInitMsg: encoder error: ", encoder.Error)
 	}
 	return buf.Bytes()
 }
 
+// Name of the rule preset, then the params as JSON in the same form clients load them from shared.json
+func prepareParamsMsg(world *entity.World) []byte {
+	paramsBytes, err := json.Marshal(world.Params)
+	if err != nil {
+		logger.Panic("prepareParamsMsg: ", err)
+	}
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(paramsMsgType)
+	encoder.WriteString(world.Preset)
+	encoder.WriteBytes(paramsBytes)
+	if encoder.Error != nil {
+		logger.Panic("prepareParamsMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
+
+func prepareMapMsg(world *entity.World) []byte {
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(mapMsgType)
+	encoder.WriteString(world.Map.Name)
+	encoder.WriteBytes(world.Map.Data)
+	if encoder.Error != nil {
+		logger.Panic("prepareMapMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
+
+// Candidates and tally of the map vote, no candidates means there is no vote running
+func prepareMapVoteMsg(world *entity.World) []byte {
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(mapVoteMsgType)
+	if !world.MapVote.Active {
+		encoder.WriteUint8(0)
+	} else {
+		counts := world.MapVoteCounts()
+		encoder.WriteUint8(uint8(len(world.MapVote.Candidates)))
+		for i, name := range world.MapVote.Candidates {
+			encoder.WriteString(name)
+			encoder.WriteUint8(uint8(counts[i]))
+		}
+	}
+	if encoder.Error != nil {
+		logger.Panic("prepareMapVoteMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
+
+func prepareNameRejectedMsg(reason string) []byte {
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(nameRejectedMsgType)
+	encoder.WriteString(reason)
+	if encoder.Error != nil {
+		logger.Panic("prepareNameRejectedMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
+
+// Names of all players that have joined
+func prepareRosterMsg(world *entity.World) []byte {
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(rosterMsgType)
+
+	numNamed := 0
+	for i := range world.PlayerList {
+		if world.PlayerList[i].Name != "" {
+			numNamed++
+		}
+	}
+	encoder.WriteUint8(uint8(numNamed))
+	for i := range world.PlayerList {
+		if world.PlayerList[i].Name == "" {
+			continue
+		}
+		encoder.WriteUint8(world.PlayerList[i].Id)
+		encoder.WriteString(world.PlayerList[i].Name)
+	}
+
+	if encoder.Error != nil {
+		logger.Panic("prepareRosterMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
+
+func prepareScoreboardMsg(world *entity.World) []byte {
+	buf := bytes.Buffer{}
+	encoder := NewEncoder(&buf)
+	encoder.WriteUint8(scoreboardMsgType)
+
+	for team := 0; team < entity.NumTeams; team++ {
+		encoder.WriteUint16(uint16(world.TeamStats[team].Kills))
+		encoder.WriteUint16(uint16(world.TeamStats[team].Captures))
+	}
+
+	numPlaying := 0
+	for i := range world.PlayerList {
+		if !world.PlayerList[i].Spectator {
+			numPlaying++
+		}
+	}
+	encoder.WriteUint8(uint8(numPlaying))
+	for i := range world.PlayerList {
+		player := &world.PlayerList[i]
+		if player.Spectator {
+			continue
+		}
+		encoder.WriteUint8(player.Id)
+		encoder.WriteInt8(int8(player.Team))
+		encoder.WriteUint16(uint16(player.Stats.Kills))
+		encoder.WriteUint16(uint16(player.Stats.Deaths))
+		encoder.WriteUint16(uint16(player.Stats.Assists))
+		encoder.WriteUint16(uint16(player.Stats.Captures))
+		encoder.WriteUint16(uint16(player.Stats.Returns))
+		encoder.WriteUint8(uint8(player.Stats.RoundWins))
+	}
+
+	if encoder.Error != nil {
+		logger.Panic("prepareScoreboardMsg: encoder error: ", encoder.Error)
+	}
+	return buf.Bytes()
+}
+
+// World state as seen by a player, or by an observer outside the world if playerIndex is -1
 func prepareWorldUpdate(world *entity.World, playerIndex int) []byte {
 	// TODO: if we start delta encoding at the byte level, then we will want each field to line up with the same bytes
 	// for each message. Otherwise comparing bytes for different fields which are likely to be different.
-	player := &world.PlayerList[playerIndex]
+	player := &entity.Player{State: entity.PlayerStateSpectating, Team: entity.TeamNone, FlagIndex: -1}
+	numOthers := len(world.PlayerList)
+	if playerIndex != -1 {
+		player = &world.PlayerList[playerIndex]
+		numOthers--
+	}
 	var buf bytes.Buffer
 	encoder := NewEncoder(&buf)
 
@@ -198,19 +498,24 @@ func prepareWorldUpdate(world *entity.World, playerIndex int) []byte {
 
 	player.ReceivedInputs = player.ReceivedInputs[:0]
 
+	encoder.WriteUint8(uint8(world.ModeId))
+	encodeMatch(&encoder, &world.Match)
+
 	encoder.WriteUint8(uint8(player.State))
+	encoder.WriteInt8(int8(player.Team))
 	encoder.WriteInt8(int8(player.FlagIndex))
 	encoder.WriteVec(player.Acked.Pos)
 	encoder.WriteUint16(uint16(player.Acked.Energy))
 	encoder.WriteUint16(uint16(player.Acked.BouncyEnergy))
 
-	encoder.WriteUint8(uint8(len(world.PlayerList) - 1))
+	encoder.WriteUint8(uint8(numOthers))
 	for i := range world.PlayerList {
 		if i == playerIndex {
 			continue
 		}
 		encoder.WriteUint8(world.PlayerList[i].Id)
 		encoder.WriteUint8(uint8(world.PlayerList[i].State))
+		encoder.WriteInt8(int8(world.PlayerList[i].Team))
 		encoder.WriteVec(world.PlayerList[i].Predicted.Pos)
 		encoder.WriteUint8(uint8(world.PlayerList[i].LastInput.GetDirNum()))
 	}
@@ -234,9 +539,32 @@ func prepareWorldUpdate(world *entity.World, playerIndex int) []byte {
 		encoder.WriteVec(world.NewHits[i])
 	}
 
+	encoder.WriteUint8(uint8(len(world.NewJailbreaks)))
+	for i := range world.NewJailbreaks {
+		encoder.WriteInt8(int8(world.NewJailbreaks[i].Team))
+		encoder.WriteVec(world.NewJailbreaks[i].Pos)
+	}
+
 	encoder.WriteUint8(uint8(len(world.FlagList)))
 	for i := range world.FlagList {
 		encoder.WriteVec(world.FlagList[i].Pos)
+		encoder.WriteInt8(int8(world.FlagList[i].Team))
+	}
+
+	encoder.WriteUint16(uint16(conf.SecsToTicks(world.Rules.HillControlSecs)))
+	encoder.WriteUint8(uint8(len(world.Hills)))
+	for i := range world.Hills {
+		hill := &world.Hills[i]
+		encoder.WriteVec(world.Map.Hills[i].Centre())
+		encoder.WriteInt8(int8(hill.Owner))
+		if hill.Contested {
+			encoder.WriteUint8(1)
+		} else {
+			encoder.WriteUint8(0)
+		}
+		for team := 0; team < entity.NumTeams; team++ {
+			encoder.WriteUint16(uint16(mymath.MinInt(hill.Control[team], math.MaxUint16))) // grows without limit in time limited rounds
+		}
 	}
 
 	if encoder.Error != nil {
@@ -245,3 +573,15 @@ func prepareWorldUpdate(world *entity.World, playerIndex int) []byte {
 
 	return buf.Bytes()
 }
+
+func encodeMatch(encoder *Encoder, match *entity.Match) {
+	encoder.WriteUint8(uint8(match.Phase))
+	encoder.WriteInt32(int32(match.PhaseTicks))
+	encoder.WriteUint8(uint8(match.Round))
+	for team := 0; team < entity.NumTeams; team++ {
+		encoder.WriteUint8(uint8(match.RoundWins[team]))
+		encoder.WriteUint16(uint16(mymath.MinInt(match.Scores[team], math.MaxUint16))) // king of the hill scores are ticks of control
+	}
+	encoder.WriteInt16(int16(match.RoundWinner)) // player id in free-for-all
+	encoder.WriteInt16(int16(match.MatchWinner))
+}
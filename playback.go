@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mode"
+	"github.com/kjander0/ctf/net"
+	"github.com/kjander0/ctf/replay"
+	"github.com/kjander0/ctf/web"
+)
+
+// Replays a recorded room as fast as possible, going through exactly the same world states as the recorded game.
+// What an observer would have been sent is added to the capture and onTick is called after every tick, if not nil.
+func PlayReplay(filename string, capture *net.Capture, onTick func(game *Game)) error {
+	reader, err := replay.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	header := reader.Header
+	conf.Shared = header.Shared
+	conf.Match = header.Match
+	var maps []*entity.Map
+	for _, m := range header.Maps {
+		maps = append(maps, entity.DecodeMap(m.Name, m.Data))
+	}
+	gameMode, err := mode.New(header.Mode)
+	if err != nil {
+		return err
+	}
+	preset := header.Preset
+	if preset.Name == "" {
+		preset = conf.DefaultPreset
+	}
+	game := NewGame(header.Room, maps, gameMode, preset, header.Seed)
+	game.capture = capture
+	logger.Infof("replaying room '%s' playing %s with seed %d", header.Room, gameMode.Name(), header.Seed)
+
+	// Fake connections feeding the game what the recorded clients sent
+	sources := map[uint32]chan []byte{}
+	var writeCs []chan []byte
+
+	event, err := reader.Next()
+	for {
+		for ; err == nil && event.Tick == game.ticks; event, err = reader.Next() {
+			switch event.Type {
+			case replay.EventJoin:
+				client := web.Client{
+					Username: "user",
+					Spectate: event.Spectate,
+					ReadC:    make(chan []byte, inboxSize),
+					WriteC:   make(chan []byte, inboxSize),
+				}
+				sources[event.Conn] = client.ReadC
+				writeCs = append(writeCs, client.WriteC)
+				game.addClient(client)
+			case replay.EventMessage:
+				sources[event.Conn] <- event.Msg
+			case replay.EventDisconnect:
+				close(sources[event.Conn])
+			case replay.EventLeave:
+				game.dropped = append(game.dropped, event.Conn)
+			case replay.EventAdmin:
+				var action AdminAction
+				if err := json.Unmarshal(event.Msg, &action); err != nil {
+					return err
+				}
+				if err := game.applyAdmin(action); err != nil {
+					return fmt.Errorf("replay: admin action failed: %w", err)
+				}
+			case replay.EventEnd:
+				logger.Infof("replay finished after %d ticks", game.ticks)
+				return nil
+			}
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			logger.Infof("replay was cut short, finished after %d ticks", game.ticks)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if event.Tick < game.ticks {
+			return fmt.Errorf("replay: event for tick %d is out of order", event.Tick)
+		}
+
+		game.update()
+		writeCs = discardMessages(writeCs)
+		if onTick != nil {
+			onTick(&game)
+		}
+	}
+}
+
+// Throws away messages sent to fake clients, returns the channels that are still open
+func discardMessages(writeCs []chan []byte) []chan []byte {
+	open := writeCs[:0]
+	for _, writeC := range writeCs {
+		closed := false
+	drain:
+		for {
+			select {
+			case _, ok := <-writeC:
+				if !ok {
+					closed = true
+					break drain
+				}
+			default:
+				break drain
+			}
+		}
+		if !closed {
+			open = append(open, writeC)
+		}
+	}
+	return open
+}
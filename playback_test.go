@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"path/filepath"
+	"testing"
+
+	"github.com/kjander0/ctf/net"
+	"github.com/kjander0/ctf/web"
+)
+
+// Messages a client would send, see net.go for the formats
+func nameMsg(name string) []byte {
+	buf := bytes.Buffer{}
+	encoder := net.NewEncoder(&buf)
+	encoder.WriteUint8(7)
+	encoder.WriteString(name)
+	return buf.Bytes()
+}
+
+func inputMsg(tick uint8, shoot bool) []byte {
+	buf := bytes.Buffer{}
+	encoder := net.NewEncoder(&buf)
+	encoder.WriteUint8(0)
+	encoder.WriteUint8(tick)
+	if shoot {
+		encoder.WriteUint8(2 | 16) // right and shoot
+		encoder.WriteFloat64(float64(tick) / 10)
+	} else {
+		encoder.WriteUint8(2 | 4) // right and up
+	}
+	return buf.Bytes()
+}
+
+// Encodes the world, leaving out what comes from outside the simulation
+func encodeWorld(t *testing.T, g *Game) []byte {
+	t.Helper()
+	snapshot := g.World.Snapshot()
+	snapshot.World.PlayerList = append(snapshot.World.PlayerList[:0:0], snapshot.World.PlayerList...)
+	for i := range snapshot.World.PlayerList {
+		snapshot.World.PlayerList[i].Token = ""
+		snapshot.World.PlayerList[i].Client = web.Client{}
+	}
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplayReproducesWorld(t *testing.T) {
+	dir := t.TempDir()
+	g := newTestGame(t)
+	g.Record(dir)
+	if g.recorder == nil {
+		t.Fatal("not recording")
+	}
+
+	client := web.Client{
+		ReadC:  make(chan []byte, inboxSize),
+		WriteC: make(chan []byte, inboxSize),
+	}
+	g.addClient(client)
+	replyC := make(chan adminReply, 1)
+	g.AdminC <- adminRequest{action: &AdminAction{Kind: AdminAddBot}, replyC: replyC}
+
+	var states [][]byte
+	for tick := 0; tick < 300; tick++ {
+		g.serveAdmin()
+		switch {
+		case tick == 2:
+			client.ReadC <- nameMsg("tester")
+		case tick > 2 && tick < 250:
+			client.ReadC <- inputMsg(uint8(tick), tick%20 == 0)
+		}
+		if tick == 250 {
+			close(client.ReadC)
+		}
+		g.update()
+		discardMessages([]chan []byte{client.WriteC})
+		states = append(states, encodeWorld(t, g))
+		if tick == 100 && len(g.World.PlayerList) != 2 {
+			t.Fatalf("room has %d players, want the client and a bot", len(g.World.PlayerList))
+		}
+	}
+	g.recorder.End(g.ticks)
+	if (<-replyC).err != nil {
+		t.Fatal("bot wasn't added")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.replay"))
+	if len(files) != 1 {
+		t.Fatalf("found replays %v, want one", files)
+	}
+	ticks := 0
+	err := PlayReplay(files[0], nil, func(game *Game) {
+		if ticks < len(states) && !bytes.Equal(encodeWorld(t, game), states[ticks]) {
+			t.Fatalf("world differs from the recording at tick %d", ticks)
+		}
+		ticks++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticks != len(states) {
+		t.Fatalf("replay ran for %d ticks, want %d", ticks, len(states))
+	}
+}
@@ -0,0 +1,286 @@
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/logger"
+)
+
+// A replay file is gzipped and starts with the magic string and a length prefixed JSON header, followed by events in
+// the order they happened. All numbers are big endian.
+const (
+	fileMagic = "CTFREPLAY"
+	Version   = 2 // version 1 had 16 bit connection ids and message lengths
+)
+
+const (
+	EventJoin       uint8 = iota // client was accepted by the room
+	EventMessage                 // message from a client was handed to the game
+	EventDisconnect              // client's connection closed
+	EventLeave                   // client's player was removed from the room
+	EventEnd                     // room closed
+	EventAdmin                   // action taken through the admin API
+)
+
+// Everything about a room that doesn't come from its clients
+type Header struct {
+	Version int
+	Room    string
+	Mode    string
+	Seed    int64
+	Shared  conf.SharedParams // defaults that presets are applied over
+	Match   conf.MatchParams
+	Preset  conf.Preset // rules the room was opened with, zero in replays recorded before presets existed
+	Maps    []MapFile   // every map in the room's rotation, in the order they were loaded
+}
+
+type MapFile struct {
+	Name string
+	Data []byte
+}
+
+type Event struct {
+	Type     uint8
+	Tick     uint32 // ticks since the room opened
+	Conn     uint32 // identifies the client, in the order they joined
+	Spectate bool   // join only
+	Msg      []byte // message, or the admin action encoded as JSON
+}
+
+// Writes a replay file. Recording is best effort, once a write fails the error is logged and nothing more is recorded.
+type Recorder struct {
+	file  *os.File
+	gz    *gzip.Writer
+	buf   *bufio.Writer
+	dirty bool  // events written since the last flush
+	err   error // first write error
+}
+
+func NewRecorder(filename string, header Header) (*Recorder, error) {
+	header.Version = Version
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	r := &Recorder{
+		file: file,
+		gz:   gz,
+		buf:  bufio.NewWriter(gz),
+	}
+	r.write([]byte(fileMagic))
+	r.write(uint32(len(headerBytes)))
+	r.write(headerBytes)
+	if r.err != nil {
+		file.Close()
+		return nil, r.err
+	}
+	return r, nil
+}
+
+func (r *Recorder) Join(tick uint32, conn uint32, spectate bool) {
+	r.writeEvent(EventJoin, tick, conn)
+	r.write(spectate)
+}
+
+func (r *Recorder) Message(tick uint32, conn uint32, msg []byte) {
+	r.writeEvent(EventMessage, tick, conn)
+	r.write(uint32(len(msg)))
+	r.write(msg)
+}
+
+func (r *Recorder) Disconnect(tick uint32, conn uint32) {
+	r.writeEvent(EventDisconnect, tick, conn)
+}
+
+func (r *Recorder) Leave(tick uint32, conn uint32) {
+	r.writeEvent(EventLeave, tick, conn)
+}
+
+func (r *Recorder) Admin(tick uint32, action []byte) {
+	r.writeEvent(EventAdmin, tick, 0)
+	r.write(uint32(len(action)))
+	r.write(action)
+}
+
+// Writes buffered events through to the file, so that little is lost if the server is killed
+func (r *Recorder) Flush() {
+	if r.err != nil || !r.dirty {
+		return
+	}
+	r.dirty = false
+	if err := r.buf.Flush(); err != nil {
+		r.fail(err)
+		return
+	}
+	if err := r.gz.Flush(); err != nil {
+		r.fail(err)
+	}
+}
+
+// Records the end of the room and closes the file
+func (r *Recorder) End(tick uint32) {
+	r.writeEvent(EventEnd, tick, 0)
+	if r.err == nil {
+		if err := r.buf.Flush(); err != nil {
+			r.fail(err)
+		} else if err := r.gz.Close(); err != nil {
+			r.fail(err)
+		}
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		logger.Error("replay: closing file: ", err)
+	}
+}
+
+func (r *Recorder) writeEvent(eventType uint8, tick uint32, conn uint32) {
+	r.write(eventType)
+	r.write(tick)
+	r.write(conn)
+	r.dirty = true
+}
+
+func (r *Recorder) write(data interface{}) {
+	if r.err != nil {
+		return
+	}
+	if err := binary.Write(r.buf, binary.BigEndian, data); err != nil {
+		r.fail(err)
+	}
+}
+
+func (r *Recorder) fail(err error) {
+	logger.Errorf("replay: recording to %s stopped: %v", r.file.Name(), err)
+	r.err = err
+}
+
+// Reads back a replay file
+type Reader struct {
+	Header Header
+	file   *os.File
+	buf    *bufio.Reader
+	ended  bool
+}
+
+func Open(filename string) (*Reader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replay: %s: %w", filename, err)
+	}
+	return reader, nil
+}
+
+func newReader(file *os.File) (*Reader, error) {
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{
+		file: file,
+		buf:  bufio.NewReader(gz),
+	}
+
+	magic := make([]byte, len(fileMagic))
+	var headerLen uint32
+	if err := r.read(magic); err != nil || string(magic) != fileMagic {
+		return nil, errors.New("not a replay file")
+	}
+	if err := r.read(&headerLen); err != nil {
+		return nil, err
+	}
+	headerBytes := make([]byte, headerLen)
+	if err := r.read(headerBytes); err != nil {
+		return nil, err
+	}
+	// Params added since the recording was made keep their defaults
+	r.Header.Shared = conf.Shared
+	r.Header.Match = conf.Match
+	if err := json.Unmarshal(headerBytes, &r.Header); err != nil {
+		return nil, err
+	}
+	if r.Header.Version < 1 || r.Header.Version > Version {
+		return nil, fmt.Errorf("unsupported version %d", r.Header.Version)
+	}
+	return r, nil
+}
+
+// Returns the next event, io.EOF after the end event. io.ErrUnexpectedEOF means the recording was cut short.
+func (r *Reader) Next() (Event, error) {
+	var event Event
+	if r.ended {
+		return event, io.EOF
+	}
+	if err := r.read(&event.Type); err != nil {
+		return event, err
+	}
+	if err := r.read(&event.Tick); err != nil {
+		return event, err
+	}
+	if err := r.readSize(&event.Conn); err != nil {
+		return event, err
+	}
+
+	switch event.Type {
+	case EventJoin:
+		if err := r.read(&event.Spectate); err != nil {
+			return event, err
+		}
+	case EventMessage, EventAdmin:
+		var msgLen uint32
+		if err := r.readSize(&msgLen); err != nil {
+			return event, err
+		}
+		event.Msg = make([]byte, msgLen)
+		if err := r.read(event.Msg); err != nil {
+			return event, err
+		}
+	case EventDisconnect, EventLeave:
+	case EventEnd:
+		r.ended = true
+	default:
+		return event, fmt.Errorf("replay: bad event type %d", event.Type)
+	}
+	return event, nil
+}
+
+// Reads a connection id or message length, which were 16 bit before version 2
+func (r *Reader) readSize(size *uint32) error {
+	if r.Header.Version >= 2 {
+		return r.read(size)
+	}
+	var size16 uint16
+	err := r.read(&size16)
+	*size = uint32(size16)
+	return err
+}
+
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Any read that runs out of data is an unexpected EOF, since the end event marks the end of the file
+func (r *Reader) read(data interface{}) error {
+	err := binary.Read(r.buf, binary.BigEndian, data)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mode"
+	"github.com/kjander0/ctf/web"
+)
+
+const (
+	maxRooms    = 32
+	defaultRoom = "main"
+)
+
+// Owns all running games and routes new clients to the room they asked for
+type RoomManager struct {
+	ClientC chan web.Client
+	maps    []*entity.Map
+	presets map[string]conf.Preset
+	rooms   map[string]*Game
+	closedC chan *Game
+	replays string // directory rooms are recorded to, empty to not record
+	stopC   chan string
+	doneC   chan struct{}
+	roomsC  chan chan []*Game
+	bans    *BanList
+}
+
+func NewRoomManager(clientC chan web.Client, maps []*entity.Map, presets map[string]conf.Preset, replays string) RoomManager {
+	return RoomManager{
+		ClientC: clientC,
+		maps:    maps,
+		presets: presets,
+		replays: replays,
+		stopC:   make(chan string),
+		doneC:   make(chan struct{}),
+		roomsC:  make(chan chan []*Game),
+		bans:    NewBanList(),
+		rooms:   map[string]*Game{},
+		closedC: make(chan *Game),
+	}
+}
+
+func (rm *RoomManager) Run() {
+	for {
+		select {
+		case client := <-rm.ClientC:
+			rm.route(client)
+		case replyC := <-rm.roomsC:
+			var games []*Game
+			for _, game := range rm.rooms {
+				games = append(games, game)
+			}
+			replyC <- games
+		case dir := <-rm.stopC:
+			rm.stopRooms(dir)
+			close(rm.doneC)
+			return
+		case game := <-rm.closedC:
+			delete(rm.rooms, game.Room)
+			logger.Infof("room '%s' closed, remaining rooms: %d", game.Room, len(rm.rooms))
+
+			// Clients may have been routed to the room after it stopped accepting them
+		drain:
+			for {
+				select {
+				case client := <-game.ClientC:
+					rm.route(client)
+				default:
+					break drain
+				}
+			}
+		}
+	}
+}
+
+// Safe to call from other goroutines
+func (rm *RoomManager) Rooms() []*Game {
+	replyC := make(chan []*Game)
+	rm.roomsC <- replyC
+	return <-replyC
+}
+
+// Saves a snapshot of every room to the directory and stops them, returns once they have all stopped
+func (rm *RoomManager) Shutdown(dir string) {
+	rm.stopC <- dir
+	<-rm.doneC
+}
+
+func (rm *RoomManager) stopRooms(dir string) {
+	for _, game := range rm.rooms {
+		game.StopC <- dir
+	}
+	for len(rm.rooms) > 0 {
+		game := <-rm.closedC
+		delete(rm.rooms, game.Room)
+	}
+}
+
+// Restores rooms saved by Shutdown, should be called before Run. Snapshots are deleted once read so that they are
+// never restored twice.
+func (rm *RoomManager) RestoreRooms(dir string) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"+snapshotExt))
+	if err != nil {
+		logger.Panic("RestoreRooms: ", err)
+	}
+	for _, filename := range filenames {
+		game, err := RestoreGame(filename, rm.maps)
+		if err := os.Remove(filename); err != nil {
+			logger.Error("RestoreRooms: ", err)
+		}
+		if err != nil {
+			logger.Errorf("Failed to restore %s: %v", filename, err)
+			continue
+		}
+		if _, ok := rm.rooms[game.Room]; ok || len(rm.rooms) >= maxRooms {
+			logger.Errorf("Not restoring room '%s', room already open or too many rooms", game.Room)
+			continue
+		}
+		rm.start(&game)
+		logger.Infof("room '%s' restored playing %s with %d players, total rooms: %d", game.Room, game.Mode.Name(), len(game.World.PlayerList), len(rm.rooms))
+	}
+}
+
+func (rm *RoomManager) route(client web.Client) {
+	if rm.bans.Contains(client.Addr) {
+		logger.Debug("rejecting connection from banned address: ", client.Addr)
+		close(client.WriteC)
+		return
+	}
+
+	room := client.Room
+	if room == "" {
+		room = defaultRoom
+	}
+
+	game, ok := rm.rooms[room]
+	if !ok {
+		if len(rm.rooms) >= maxRooms {
+			logger.Debug("too many rooms, rejecting connection")
+			close(client.WriteC)
+			return
+		}
+		gameMode, err := mode.New(client.Mode)
+		if err != nil {
+			logger.Debug("route: ", err)
+			close(client.WriteC)
+			return
+		}
+		presetName := client.Preset
+		if presetName == "" {
+			presetName = conf.DefaultPresetName
+		}
+		preset, ok := rm.presets[presetName]
+		if !ok {
+			logger.Debug("route: unknown preset: ", presetName)
+			close(client.WriteC)
+			return
+		}
+		game = rm.openRoom(room, gameMode, preset)
+	}
+
+	select {
+	case game.ClientC <- client:
+	default:
+		logger.Debugf("room '%s' is busy, rejecting connection", room)
+		close(client.WriteC)
+	}
+}
+
+func (rm *RoomManager) openRoom(room string, gameMode mode.GameMode, preset conf.Preset) *Game {
+	game := NewGame(room, rm.maps, gameMode, preset, time.Now().UnixNano())
+	if rm.replays != "" {
+		game.Record(rm.replays) // restored rooms can't be recorded, since replays must start from a new world
+	}
+	rm.start(&game)
+	logger.Infof("room '%s' opened playing %s (%s rules) with seed %d, total rooms: %d", room, gameMode.Name(), preset.Name, game.World.Seed, len(rm.rooms))
+	return &game
+}
+
+func (rm *RoomManager) start(game *Game) {
+	rm.rooms[game.Room] = game
+	go func() {
+		game.Run()
+		rm.closedC <- game
+	}()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mymath"
+)
+
+// Loads every map file in a directory, sorted by name
+func LoadMaps(dir string) []*entity.Map {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Panic("Failed to read map directory: ", dir)
+	}
+
+	var maps []*entity.Map
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".bin" {
+			continue
+		}
+		gameMap := entity.LoadMap(filepath.Join(dir, entry.Name()))
+		if err := gameMap.Validate(); err != nil {
+			logger.Errorf("Skipping map %s: %v", gameMap.Name, err)
+			continue
+		}
+		maps = append(maps, gameMap)
+	}
+	if len(maps) == 0 {
+		logger.Panic("No maps found in directory: ", dir)
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		return maps[i].Name < maps[j].Name
+	})
+	return maps
+}
+
+// Order in which a room plays through its maps
+type MapRotation struct {
+	maps    []*entity.Map
+	shuffle bool
+	rng     entity.Rand // seeded from the world so that replays play the same maps
+	order   []int
+	next    int
+}
+
+// Rotation state saved in game snapshots. Maps are saved by name, since different maps may be loaded after a restart.
+type RotationSnapshot struct {
+	Order []string
+	Next  int
+	Rand  entity.Rand
+}
+
+func NewMapRotation(maps []*entity.Map, shuffle bool, seed int64) MapRotation {
+	rotation := MapRotation{
+		maps:    maps,
+		shuffle: shuffle,
+		rng:     entity.NewRand(seed),
+	}
+	rotation.reorder()
+	return rotation
+}
+
+// Returns false if any of the maps in the snapshot are no longer loaded
+func RestoreMapRotation(maps []*entity.Map, shuffle bool, snapshot RotationSnapshot) (MapRotation, bool) {
+	rotation := MapRotation{
+		maps:    maps,
+		shuffle: shuffle,
+		rng:     snapshot.Rand,
+		next:    snapshot.Next,
+	}
+	for _, name := range snapshot.Order {
+		index := findMap(maps, name)
+		if index == -1 {
+			return rotation, false
+		}
+		rotation.order = append(rotation.order, index)
+	}
+	if len(rotation.order) != len(maps) || rotation.next >= len(rotation.order) {
+		return rotation, false // maps have been added since
+	}
+	return rotation, true
+}
+
+func (r *MapRotation) Snapshot() RotationSnapshot {
+	snapshot := RotationSnapshot{
+		Next: r.next,
+		Rand: r.rng,
+	}
+	for _, index := range r.order {
+		snapshot.Order = append(snapshot.Order, r.maps[index].Name)
+	}
+	return snapshot
+}
+
+// Returns -1 if there is no map with the name
+func findMap(maps []*entity.Map, name string) int {
+	for i := range maps {
+		if maps[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the next map in the rotation and advances it
+func (r *MapRotation) Next() *entity.Map {
+	m := r.maps[r.order[r.next]]
+	r.advance(1)
+	return m
+}
+
+// Returns up to count upcoming maps, without advancing the rotation
+func (r *MapRotation) Upcoming(count int) []*entity.Map {
+	count = mymath.MinInt(count, len(r.maps))
+	upcoming := make([]*entity.Map, count)
+	for i := range upcoming {
+		upcoming[i] = r.maps[r.order[(r.next+i)%len(r.order)]]
+	}
+	return upcoming
+}
+
+// Moves the rotation past the chosen map, so that it is not played again straight away
+func (r *MapRotation) Skip(chosen *entity.Map) {
+	for i := 0; i < len(r.order); i++ {
+		if r.maps[r.order[(r.next+i)%len(r.order)]] == chosen {
+			r.advance(i + 1)
+			return
+		}
+	}
+}
+
+func (r *MapRotation) advance(steps int) {
+	r.next += steps
+	if r.next >= len(r.order) {
+		r.next = 0
+		r.reorder()
+	}
+}
+
+func (r *MapRotation) reorder() {
+	r.order = make([]int, len(r.maps))
+	for i := range r.order {
+		r.order[i] = i
+	}
+	if r.shuffle {
+		for i := len(r.order) - 1; i > 0; i-- {
+			j := r.rng.Intn(i + 1)
+			r.order[i], r.order[j] = r.order[j], r.order[i]
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+)
+
+const maxChunkTiles = 32 // most tiles a single map file chunk can hold
+
+// Characters used to draw maps in ASCII. Triangle walls need an orientation so they can't be drawn.
+var ASCIITiles = map[rune]*entity.TileType{
+	' ': entity.TileTypeEmpty,
+	'.': entity.TileTypeFloor,
+	'#': entity.TileTypeWall,
+	'g': entity.TileTypeGreenSpawn,
+	'r': entity.TileTypeRedSpawn,
+	'b': entity.TileTypeBlueSpawn,
+	'y': entity.TileTypeYellowSpawn,
+	'G': entity.TileTypeGreenJail,
+	'R': entity.TileTypeRedJail,
+	'B': entity.TileTypeBlueJail,
+	'Y': entity.TileTypeYellowJail,
+	'1': entity.TileTypeGreenFlagGoal,
+	'2': entity.TileTypeRedFlagGoal,
+	'3': entity.TileTypeBlueFlagGoal,
+	'4': entity.TileTypeYellowFlagGoal,
+	'5': entity.TileTypeGreenJailRelease,
+	'6': entity.TileTypeRedJailRelease,
+	'7': entity.TileTypeBlueJailRelease,
+	'8': entity.TileTypeYellowJailRelease,
+	'F': entity.TileTypeFlagSpawn,
+	'H': entity.TileTypeCaptureZone,
+}
+
+// Builds a map from rows of ASCII, top row first, by encoding it the same way as a map file. Rows must be the same
+// length.
+func MapFromASCII(name string, rows []string) *entity.Map {
+	if len(rows) == 0 {
+		logger.Panic("MapFromASCII: no rows")
+	}
+
+	var typeIds []int
+	for i := len(rows) - 1; i >= 0; i-- { // map files start from the bottom row
+		row := []rune(rows[i])
+		if len(row) != len([]rune(rows[0])) {
+			logger.Panicf("MapFromASCII: row %d has a different length", i)
+		}
+		for _, c := range row {
+			tileType, ok := ASCIITiles[c]
+			if !ok {
+				logger.Panicf("MapFromASCII: unknown tile '%c'", c)
+			}
+			typeIds = append(typeIds, tileType.Id)
+		}
+	}
+
+	buf := bytes.Buffer{}
+	binary.Write(&buf, binary.BigEndian, uint16(len([]rune(rows[0]))))
+	for start := 0; start < len(typeIds); {
+		count := 1
+		for start+count < len(typeIds) && typeIds[start+count] == typeIds[start] && count < maxChunkTiles {
+			count++
+		}
+		// type id, orientation, variation, tile count - 1
+		bits := uint16(typeIds[start])<<11 | uint16(count-1)
+		binary.Write(&buf, binary.BigEndian, bits)
+		start += count
+	}
+	return entity.DecodeMap(name, buf.Bytes())
+}
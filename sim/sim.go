@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"fmt"
+
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mode"
+	"github.com/kjander0/ctf/mymath"
+	"github.com/kjander0/ctf/web"
+)
+
+// Headless world driven by scripted inputs, for testing gameplay without clients
+type Sim struct {
+	World  entity.World
+	Mode   mode.GameMode
+	Hits   []mymath.Vec // positions of every laser hit so far
+	inputs map[uint8][]entity.PlayerInput
+}
+
+// Starts a live round on the map, so objectives count straight away. Runs with the same seed and inputs play out
+// exactly the same.
+func New(gameMap *entity.Map, gameMode mode.GameMode, seed int64) *Sim {
+	world := entity.NewWorld(gameMap, seed)
+	world.ModeId = gameMode.Id()
+	world.Match.Phase = entity.MatchPhaseLive
+	gameMode.RoundSetup(&world)
+	return &Sim{
+		World:  world,
+		Mode:   gameMode,
+		inputs: map[uint8][]entity.PlayerInput{},
+	}
+}
+
+// Adds a fake player that starts alive at the first spawn of their team, returns their id
+func (s *Sim) AddPlayer(team int) uint8 {
+	ok, id := s.World.NextPlayerId()
+	if !ok {
+		logger.Panic("sim: world is full")
+	}
+
+	player := entity.NewPlayer(id, team, web.Client{}, s.World.Params)
+	player.IsBot = true // has no connection
+	player.Name = fmt.Sprintf("Player %d", id)
+	player.NetState = entity.PlayerNetStateReady
+	player.State = entity.PlayerStateAlive
+	player.Acked.Pos = s.World.Map.TeamSpawns(team)[0]
+	player.Predicted = player.Acked
+	s.World.PlayerList = append(s.World.PlayerList, player)
+	return id
+}
+
+// Panics if there is no player with the id
+func (s *Sim) Player(id uint8) *entity.Player {
+	player := s.World.FindPlayer(id)
+	if player == nil {
+		logger.Panic("sim: no player with id ", id)
+	}
+	return player
+}
+
+// Moves a player, e.g. to set up a scenario
+func (s *Sim) Teleport(id uint8, pos mymath.Vec) {
+	player := s.Player(id)
+	player.Acked.Pos = pos
+	player.Predicted.Pos = pos
+}
+
+// Queues inputs for a player, one is applied each tick. Players without queued inputs stand still.
+func (s *Sim) QueueInputs(id uint8, inputs ...entity.PlayerInput) {
+	s.inputs[id] = append(s.inputs[id], inputs...)
+}
+
+func (s *Sim) Step() {
+	for i := range s.World.PlayerList {
+		player := &s.World.PlayerList[i]
+		var input entity.PlayerInput
+		if queue := s.inputs[player.Id]; len(queue) > 0 {
+			input = queue[0]
+			s.inputs[player.Id] = queue[1:]
+		}
+		input.Tick = s.World.Tick
+		player.ReceivedInputs = append(player.ReceivedInputs[:0], input)
+		player.LastInput = input
+	}
+
+	Step(&s.World, s.Mode)
+	s.Hits = append(s.Hits, s.World.NewHits...)
+	s.World.Tick++
+}
+
+func (s *Sim) Run(ticks int) {
+	for i := 0; i < ticks; i++ {
+		s.Step()
+	}
+}
+
+// The same input for a number of ticks, e.g. to hold a movement key down
+func Repeat(input entity.PlayerInput, ticks int) []entity.PlayerInput {
+	inputs := make([]entity.PlayerInput, ticks)
+	for i := range inputs {
+		inputs[i] = input
+	}
+	return inputs
+}
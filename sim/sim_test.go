@@ -0,0 +1,151 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/mode"
+)
+
+// Rows are numbered from the bottom, so the flag spawn is at row 4, column 7
+var testRows = []string{
+	"############",
+	"#G........R#",
+	"#..........#",
+	"#.1....F...#",
+	"#g...#....r#",
+	"#....#.....#",
+	"#..........#",
+	"############",
+}
+
+func newTestSim(t *testing.T) *Sim {
+	t.Helper()
+	gameMode, err := mode.New("ctf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(MapFromASCII("test", testRows), gameMode, 1)
+}
+
+func TestMapFromASCII(t *testing.T) {
+	gameMap := MapFromASCII("test", testRows)
+	if len(gameMap.Rows) != len(testRows) || len(gameMap.Rows[0]) != len(testRows[0]) {
+		t.Fatalf("map is %dx%d, want %dx%d", len(gameMap.Rows[0]), len(gameMap.Rows), len(testRows[0]), len(testRows))
+	}
+	if tile := gameMap.Rows[3][5]; tile.Type != entity.TileTypeWall {
+		t.Errorf("tile at row 3, column 5 has type %d, want a wall", tile.Type.Id)
+	}
+	if len(gameMap.FlagSpawns) != 1 || gameMap.FlagSpawns[0] != entity.TileCentre(4, 7) {
+		t.Errorf("flag spawns are %v, want one at %v", gameMap.FlagSpawns, entity.TileCentre(4, 7))
+	}
+	if teams := gameMap.Teams(); len(teams) != 2 {
+		t.Errorf("map has teams %v, want green and red", teams)
+	}
+}
+
+func TestWallBlocksMovement(t *testing.T) {
+	s := newTestSim(t)
+	id := s.AddPlayer(entity.TeamGreen)
+	start := entity.TileCentre(2, 3)
+	s.Teleport(id, start)
+
+	s.QueueInputs(id, Repeat(entity.PlayerInput{Right: true}, 60)...)
+	s.Run(60)
+
+	wallLeft := entity.TileBottomLeft(2, 5).X
+	pos := s.Player(id).Acked.Pos
+	if pos.X <= start.X {
+		t.Fatalf("player didn't move, at %v", pos)
+	}
+	if pos.X > wallLeft-conf.Shared.PlayerRadius+1e-6 {
+		t.Fatalf("player at %v overlaps the wall starting at x=%v", pos, wallLeft)
+	}
+}
+
+func TestLaserHitLowersHealth(t *testing.T) {
+	s := newTestSim(t)
+	shooter := s.AddPlayer(entity.TeamGreen)
+	target := s.AddPlayer(entity.TeamRed)
+	s.Teleport(shooter, entity.TileCentre(5, 2))
+	s.Teleport(target, entity.TileCentre(5, 9))
+	health := s.Player(target).Health
+
+	s.QueueInputs(shooter, entity.PlayerInput{ShootPrimary: true, AimAngle: 0})
+	s.Run(30)
+
+	if got := s.Player(target).Health; got != health-1 {
+		t.Fatalf("target has health %d, want %d", got, health-1)
+	}
+	if len(s.Hits) == 0 {
+		t.Fatal("no hit was recorded")
+	}
+}
+
+func TestFlagCapture(t *testing.T) {
+	s := newTestSim(t)
+	id := s.AddPlayer(entity.TeamGreen)
+	s.Teleport(id, entity.TileCentre(4, 7))
+
+	s.Step()
+	if s.Player(id).FlagIndex != 0 {
+		t.Fatal("player didn't pick up the flag")
+	}
+
+	s.QueueInputs(id, Repeat(entity.PlayerInput{Left: true}, 90)...)
+	s.Run(90)
+
+	flag := s.World.FlagList[0]
+	if flag.Team != entity.TeamGreen || flag.Pos != entity.TileCentre(4, 2) {
+		t.Fatalf("flag is at %v with team %d, want it delivered to the green goal", flag.Pos, flag.Team)
+	}
+	if captures := s.World.TeamStats[entity.TeamGreen].Captures; captures != 1 {
+		t.Fatalf("green has %d captures, want 1", captures)
+	}
+	if score := s.Mode.Score(&s.World, entity.TeamGreen); score != 1 {
+		t.Fatalf("green has score %d, want 1", score)
+	}
+}
+
+func TestPlayerStartsWithWorldParams(t *testing.T) {
+	s := newTestSim(t)
+	s.World.Params.PlayerHealth = 1
+	s.World.Params.MaxLaserEnergy = 40
+	id := s.AddPlayer(entity.TeamGreen)
+
+	player := s.Player(id)
+	if player.Health != 1 || player.Acked.Energy != 40 {
+		t.Fatalf("player has health %d and energy %d, want 1 and 40", player.Health, player.Acked.Energy)
+	}
+}
+
+func TestSpectatorAtZeroHealthStaysSpectating(t *testing.T) {
+	s := newTestSim(t)
+	id := s.AddPlayer(entity.TeamGreen)
+	entity.Spectate(&s.World, s.Player(id))
+	s.Player(id).Health = 0 // e.g. hit on the tick they switched
+
+	s.Run(conf.Shared.JailTimeTicks + 1)
+
+	if player := s.Player(id); player.State != entity.PlayerStateSpectating || player.Team != entity.TeamNone {
+		t.Fatalf("spectator has state %d and team %d, want spectating with no team", player.State, player.Team)
+	}
+}
+
+func TestLaserPassesThroughSpectator(t *testing.T) {
+	s := newTestSim(t)
+	shooter := s.AddPlayer(entity.TeamGreen)
+	spectator := s.AddPlayer(entity.TeamRed)
+	s.Teleport(shooter, entity.TileCentre(5, 2))
+	s.Teleport(spectator, entity.TileCentre(5, 9))
+	entity.Spectate(&s.World, s.Player(spectator))
+	health := s.Player(spectator).Health
+
+	s.QueueInputs(shooter, entity.PlayerInput{ShootPrimary: true, AimAngle: 0})
+	s.Run(30)
+
+	if got := s.Player(spectator).Health; got != health {
+		t.Fatalf("spectator has health %d, want %d", got, health)
+	}
+}
@@ -0,0 +1,17 @@
+package sim
+
+import (
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/mode"
+)
+
+// Advances the world by one tick once inputs have been received. This is the same sequence used by the game
+// loop, so the simulation can be run without a network.
+func Step(world *entity.World, gameMode mode.GameMode) {
+	entity.UpdatePlayers(world)
+	entity.UpdateProjectiles(world)
+	entity.UpdateJailbreaks(world)
+	if !world.Match.Frozen() {
+		gameMode.Update(world)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kjander0/ctf/bot"
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/mode"
+	"github.com/kjander0/ctf/web"
+)
+
+const (
+	snapshotExt   = ".snapshot"
+	reconnectSecs = 60 // players restored from a snapshot are removed if their client doesn't reconnect in time
+	tokenBytes    = 16
+)
+
+// Everything needed to carry on a game after a server restart
+type GameSnapshot struct {
+	Room     string
+	Mode     string
+	World    entity.WorldSnapshot
+	Rotation RotationSnapshot
+	VoteMaps []string
+
+	Preset        conf.Preset
+	NextPreset    *conf.Preset
+	ParamsHistory []ParamsChange
+}
+
+// Saves the game to a file named after the room, should only be called from the game loop
+func (g *Game) SaveSnapshot(dir string) error {
+	snapshot := GameSnapshot{
+		Room:     g.Room,
+		Mode:     g.Mode.Name(),
+		World:    g.World.Snapshot(),
+		Rotation: g.rotation.Snapshot(),
+
+		Preset:        g.preset,
+		NextPreset:    g.nextPreset,
+		ParamsHistory: g.paramsHistory,
+	}
+	for _, m := range g.voteMaps {
+		snapshot.VoteMaps = append(snapshot.VoteMaps, m.Name)
+	}
+
+	filename := filepath.Join(dir, g.Room+snapshotExt)
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(snapshot); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	logger.Infof("room '%s': saved snapshot to %s", g.Room, filename)
+	return nil
+}
+
+// Restores a saved game, its players have reconnectSecs for their clients to reconnect
+func RestoreGame(filename string, maps []*entity.Map) (Game, error) {
+	var snapshot GameSnapshot
+	file, err := os.Open(filename)
+	if err != nil {
+		return Game{}, err
+	}
+	defer file.Close()
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return Game{}, err
+	}
+
+	gameMode, err := mode.New(snapshot.Mode)
+	if err != nil {
+		return Game{}, err
+	}
+	mapIndex := findMap(maps, snapshot.World.MapName)
+	if mapIndex == -1 {
+		return Game{}, fmt.Errorf("map '%s' is no longer loaded", snapshot.World.MapName)
+	}
+	world := entity.RestoreWorld(snapshot.World, maps[mapIndex])
+	if snapshot.Preset.Name == "" {
+		snapshot.Preset = conf.DefaultPreset // saved before presets existed
+	}
+	_, rules, err := gameRules(snapshot.Preset, world.Map)
+	if err != nil {
+		return Game{}, err
+	}
+	world.Rules = rules // match rules may have been reconfigured, unlike params they aren't tuned
+
+	rotation, ok := RestoreMapRotation(maps, conf.Match.MapShuffle, snapshot.Rotation)
+	if !ok {
+		logger.Infof("room '%s': maps have changed, starting a new map rotation", snapshot.Room)
+		rotation = NewMapRotation(maps, conf.Match.MapShuffle, world.Seed)
+	}
+
+	game := Game{
+		Room:     snapshot.Room,
+		ClientC:  make(chan web.Client, 10),
+		StopC:    make(chan string, 1),
+		AdminC:   make(chan adminRequest, 10),
+		World:    world,
+		Mode:     gameMode,
+		rotation: rotation,
+		bots:     bot.NewController(),
+		maps:     maps,
+		inboxes:  map[uint8]*inbox{},
+
+		preset:        snapshot.Preset,
+		nextPreset:    snapshot.NextPreset,
+		paramsHistory: snapshot.ParamsHistory,
+	}
+
+	for _, name := range snapshot.VoteMaps {
+		index := findMap(maps, name)
+		if index == -1 {
+			game.voteMaps = nil
+			game.World.MapVote = entity.MapVote{Changed: true} // the next map will come from the rotation instead
+			break
+		}
+		game.voteMaps = append(game.voteMaps, maps[index])
+	}
+
+	for i := range game.World.PlayerList {
+		player := &game.World.PlayerList[i]
+		if player.IsBot {
+			game.bots.Adopt(player)
+			continue
+		}
+		player.Client = web.Client{Username: player.Client.Username}
+		player.ReconnectTicks = conf.SecsToTicks(reconnectSecs)
+	}
+	return game, nil
+}
+
+// Gives a client back the player it had before a server restart, returns false if there is no such player
+func (g *Game) reconnect(client web.Client, conn uint32) bool {
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		if player.ReconnectTicks == 0 || player.Token != client.Token {
+			continue
+		}
+
+		g.inboxes[player.Id] = &inbox{conn: conn, source: client.ReadC}
+		client.ReadC = make(chan []byte, inboxSize)
+		client.Username = player.Client.Username
+		player.Client = client
+		player.ReconnectTicks = 0
+		player.NetState = entity.PlayerNetStateJoining
+		player.SentJoinState = false
+		player.ReceivedInputs = player.ReceivedInputs[:0]
+		logger.Infof("room '%s': '%s' reconnected", g.Room, player.Client.Username)
+		return true
+	}
+	return false
+}
+
+// Removes restored players whose clients haven't reconnected in time
+func (g *Game) expireReconnects() {
+	for i := range g.World.PlayerList {
+		player := &g.World.PlayerList[i]
+		if player.ReconnectTicks == 0 {
+			continue
+		}
+		player.ReconnectTicks--
+		if player.ReconnectTicks == 0 {
+			player.DoDisconnect = true
+		}
+	}
+}
+
+func newToken() string {
+	token := make([]byte, tokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		logger.Panic("newToken: ", err)
+	}
+	return hex.EncodeToString(token)
+}
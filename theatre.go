@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/logger"
+	"github.com/kjander0/ctf/net"
+	"github.com/kjander0/ctf/web"
+)
+
+// Streams a captured match to every client that connects, each watching at their own pace
+type Theatre struct {
+	ClientC chan web.Client
+	capture *net.Capture
+	viewers []*net.Viewer
+}
+
+func NewTheatre(clientC chan web.Client, capture *net.Capture) Theatre {
+	return Theatre{
+		ClientC: clientC,
+		capture: capture,
+	}
+}
+
+func (t *Theatre) Run() {
+	ticker := NewTicker(float64(conf.Shared.TickRate))
+	ticker.Start()
+
+	for {
+		select {
+		case client := <-t.ClientC:
+			t.viewers = append(t.viewers, net.NewViewer(client, t.capture))
+			logger.Infof("viewer joined, total viewers: %d", len(t.viewers))
+		default:
+		}
+
+		for i := len(t.viewers) - 1; i >= 0; i-- { // loop backwards for removing elements
+			if !t.viewers[i].Update() {
+				t.viewers[i] = t.viewers[len(t.viewers)-1]
+				t.viewers = t.viewers[:len(t.viewers)-1]
+				logger.Infof("viewer left, remaining viewers: %d", len(t.viewers))
+			}
+		}
+
+		ticker.Sleep()
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kjander0/ctf/conf"
+	"github.com/kjander0/ctf/entity"
+	"github.com/kjander0/ctf/logger"
+)
+
+// A change to the shared params of a running game
+type ParamsChange struct {
+	Time    time.Time
+	Tick    uint32   // ticks since the room opened
+	Changed []string // names of the params that changed
+	Preset  string   // preset that was switched to, empty if the params were tuned by hand
+	Map     string   // map that was changed to, empty if the map didn't change
+	Params  conf.SharedParams
+}
+
+// Applies a JSON object holding some of the shared params, clients are sent the new params at the end of the tick.
+// Should be called between ticks.
+func (g *Game) tuneParams(changes []byte) error {
+	params, changed, err := g.World.Params.WithChanges(changes)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return errors.New("no params changed")
+	}
+	g.setParams(params, changed, "", "")
+	logger.Infof("room '%s': changed params %s", g.Room, strings.Join(changed, ", "))
+	return nil
+}
+
+// Replaces the shared params with those of a preset, undoing any tuning. Should be called between ticks.
+func (g *Game) applyPreset(preset conf.Preset) error {
+	params, _, err := gameRules(preset, g.World.Map)
+	if err != nil {
+		return err
+	}
+	g.preset = preset
+	g.World.Preset = preset.Name
+	g.setParams(params, g.World.Params.Diff(params), preset.Name, "")
+	logger.Infof("room '%s': switched to preset '%s'", g.Room, preset.Name)
+	return nil
+}
+
+// Switches the params and rules to those of a new map, undoing any tuning. Should be called with the new map.
+func (g *Game) applyMapOverrides() {
+	params, rules, err := gameRules(g.preset, g.World.Map)
+	if err != nil {
+		logger.Errorf("room '%s': keeping the current rules, map '%s' can't be played with preset '%s': %v", g.Room,
+			g.World.Map.Name, g.preset.Name, err)
+		return
+	}
+	g.World.Rules = rules
+	if changed := g.World.Params.Diff(params); len(changed) > 0 {
+		g.setParams(params, changed, "", g.World.Map.Name)
+	}
+}
+
+// Params and rules of a game before any tuning, from its preset and the overrides of the map being played
+func gameRules(preset conf.Preset, gameMap *entity.Map) (conf.SharedParams, conf.MatchParams, error) {
+	params, err := preset.Apply(conf.Shared)
+	if err != nil {
+		return params, conf.Match, err
+	}
+	params, err = gameMap.Params(params)
+	if err != nil {
+		return params, conf.Match, err
+	}
+	rules, err := gameMap.Rules(conf.Match)
+	return params, rules, err
+}
+
+func (g *Game) setParams(params conf.SharedParams, changed []string, preset string, mapName string) {
+	g.World.Params = params
+	g.World.ParamsChanged = true
+	g.paramsHistory = append(g.paramsHistory, ParamsChange{
+		Time:    time.Now(),
+		Tick:    g.ticks,
+		Changed: changed,
+		Preset:  preset,
+		Map:     mapName,
+		Params:  params,
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import "github.com/kjander0/ctf/entity"
+
+func (g *Game) startMapVote() {
+	if g.World.Rules.MapVoteCandidates < 2 {
+		return
+	}
+	g.voteMaps = g.rotation.Upcoming(g.World.Rules.MapVoteCandidates)
+	if len(g.voteMaps) < 2 {
+		return
+	}
+
+	vote := entity.MapVote{
+		Active:  true,
+		Changed: true,
+	}
+	for _, m := range g.voteMaps {
+		vote.Candidates = append(vote.Candidates, m.Name)
+	}
+	g.World.MapVote = vote
+	for i := range g.World.PlayerList {
+		g.World.PlayerList[i].MapVote = -1
+	}
+}
+
+// Returns the map with the most votes, or the next map in the rotation if there was no vote
+func (g *Game) endMapVote() *entity.Map {
+	if !g.World.MapVote.Active {
+		return g.rotation.Next()
+	}
+
+	counts := g.World.MapVoteCounts()
+	best := 0
+	for i := range counts {
+		if counts[i] > counts[best] {
+			best = i
+		}
+	}
+	chosen := g.voteMaps[best]
+	g.rotation.Skip(chosen)
+	g.voteMaps = nil
+	return chosen
+}
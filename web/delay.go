@@ -4,12 +4,8 @@ import (
 	"math/rand"
 	"sync"
 	"time"
-)
 
-const (
-	delayMs  = 0
-	jitterMs = 0
-	lossRate = 0
+	"github.com/kjander0/ctf/conf"
 )
 
 // Channel for adding artificial delay/jitter to data
@@ -42,6 +38,10 @@ func (dc *DelayChannel) Start() {
 				return
 			}
 
+			delayMs := conf.Server.Network.DelayMs
+			jitterMs := conf.Server.Network.JitterMs
+			lossRate := conf.Server.Network.LossRate
+
 			durationMs := delayMs
 			if jitterMs > 0 {
 				durationMs += 2*rand.Intn(jitterMs) - jitterMs
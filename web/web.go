@@ -1,17 +1,17 @@
 package web
 
 import (
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kjander0/ctf/conf"
 	"github.com/kjander0/ctf/logger"
 )
 
 const (
-	connTimeout    = 10 * time.Second
-	pingPeriod     = 5 * time.Second
-	maxMessageSize = 1024
+	maxRoomLen = 16
 )
 
 type WebServer struct {
@@ -21,6 +21,12 @@ type WebServer struct {
 
 type Client struct {
 	Username string
+	Room     string // room code requested by the client, empty for the default room
+	Mode     string // game mode to play if the room has to be opened, empty for the default mode
+	Preset   string // rule preset to play with if the room has to be opened, empty for the default rules
+	Spectate bool   // join as a spectator rather than a player
+	Token    string // given to the client when it joined, lets it back into its player after a server restart
+	Addr     string // ip address the client connected from
 	ReadC    chan []byte
 	WriteC   chan []byte
 }
@@ -34,14 +40,15 @@ var upgrader = websocket.Upgrader{}
 func NewWebServer() WebServer {
 	return WebServer{
 		ClientC:   make(chan Client, 10),
-		fsHandler: http.FileServer(http.Dir("www")),
+		fsHandler: http.FileServer(http.Dir(conf.Server.Paths.WWW)),
 	}
 }
 
 func (ws *WebServer) Run() error {
 	http.HandleFunc("/", ws.handleHttp)
 	http.HandleFunc("/ws", ws.handleWs)
-	return http.ListenAndServe(":8000", nil)
+	logger.Info("listening on ", conf.Server.Network.Addr)
+	return http.ListenAndServe(conf.Server.Network.Addr, nil)
 }
 
 func NewClient() Client {
@@ -65,6 +72,15 @@ func (ws *WebServer) handleWs(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("handleWs: new connection from: ", r.RemoteAddr)
 
 	client := NewClient()
+	client.Room = r.URL.Query().Get("room")
+	client.Mode = r.URL.Query().Get("mode")
+	client.Preset = r.URL.Query().Get("preset")
+	client.Spectate = r.URL.Query().Get("spectate") == "1"
+	client.Token = r.URL.Query().Get("token")
+	client.Addr = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client.Addr = host
+	}
 
 	// BEGIN DEBUG delayed packets
 	dRead := NewDelayChannel()
@@ -91,10 +107,29 @@ func (ws *WebServer) serviceClient(client Client) {
 	// TODO: can read authentication/username here
 	client.Username = "user"
 
+	if !validRoom(client.Room) {
+		logger.Debug("serviceClient: bad room code: ", client.Room)
+		close(client.WriteC)
+		return
+	}
+
 	// pass ownership to game logic
 	ws.ClientC <- client
 }
 
+// Room codes are short and restricted to url safe characters
+func validRoom(room string) bool {
+	if len(room) > maxRoomLen {
+		return false
+	}
+	for _, c := range room {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 /*
 Gorilla WS require all read from same goroutine, so we do it here.
 readC will be closed when the connection ends.
@@ -106,7 +141,8 @@ func readPump(conn *websocket.Conn, readC chan []byte) {
 		close(readC)
 	}()
 
-	conn.SetReadLimit(maxMessageSize)
+	connTimeout := time.Duration(conf.Server.Network.ConnTimeoutSecs) * time.Second
+	conn.SetReadLimit(int64(conf.Server.Network.MaxMessageBytes))
 
 	for {
 		conn.SetPongHandler(
@@ -150,7 +186,8 @@ func readPump(conn *websocket.Conn, readC chan []byte) {
 Gorilla WS require all write from same goroutine, so we do it here
 */
 func writePump(conn *websocket.Conn, writeC chan []byte) {
-	ticker := time.NewTicker(pingPeriod)
+	connTimeout := time.Duration(conf.Server.Network.ConnTimeoutSecs) * time.Second
+	ticker := time.NewTicker(time.Duration(conf.Server.Network.PingSecs) * time.Second)
 	defer func() {
 		logger.Debug("writePump: closing")
 		ticker.Stop()
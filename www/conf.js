@@ -10,6 +10,7 @@ let PLAYER_RADIUS;
 let LASER_SPEED;
 let LASER_TIME_TICKS;
 let LASER_ENERGY_COST;
+let LASER_ENABLED;
 let BOUNCY_ENERGY_COST;
 let BOUNCY_SPEED;
 let MAX_BOUNCES;
@@ -17,7 +18,11 @@ let MAX_BOUNCES;
 async function retrieveConf()
 {
     let text = await assets.requestText('shared.json');
-    let config = JSON.parse(text);
+    applyConf(JSON.parse(text));
+}
+
+// Also called when the server changes the params of a running game
+function applyConf(config) {
     UPDATE_MS = 1000 / config.TickRate;
     TILE_SIZE = config.TileSize;
     PLAYER_SPEED = config.PlayerSpeed;
@@ -28,6 +33,7 @@ async function retrieveConf()
     LASER_SPEED = config.LaserSpeed;
     LASER_TIME_TICKS= config.LaserTimeTicks;
     LASER_ENERGY_COST = config.LaserEnergyCost;
+    LASER_ENABLED = config.LaserEnabled;
     BOUNCY_ENERGY_COST = config.BouncyEnergyCost;
     BOUNCY_SPEED = config.BouncySpeed;
     MAX_BOUNCES = config.MaxBounces;
@@ -35,6 +41,7 @@ async function retrieveConf()
 
 export {
     retrieveConf,
+    applyConf,
     UPDATE_MS,
     TILE_SIZE,
     PLAYER_SPEED,
@@ -45,6 +52,7 @@ export {
     LASER_SPEED,
     LASER_TIME_TICKS,
     LASER_ENERGY_COST,
+    LASER_ENABLED,
     BOUNCY_ENERGY_COST,
     BOUNCY_SPEED,
     MAX_BOUNCES,
@@ -15,6 +15,7 @@ import { marshal, unmarshal } from "../map/marshal.js";
 // - show error if badly formatted map file
 
 let tileRows;
+let mapOverrides = {}; // gameplay values that differ while the map is played, e.g. {"Shared": {"PlayerSpeed": 3}}
 
 // Render
 let canvas;
@@ -204,8 +205,14 @@ function initUI() {
         saveFile();
     };
 
+    const overridesBtn = new UIButton(new UIText("Overrides", assets.arialFont));
+    overridesBtn.onmousedown = () => {
+        editOverrides();
+    };
+
     actionButtonsFrame.addChild(importBtn);
     actionButtonsFrame.addChild(exportBtn);
+    actionButtonsFrame.addChild(overridesBtn);
 }
 
 function pickFile() {
@@ -213,14 +220,43 @@ function pickFile() {
     picker.onchange = async () => {
         if (picker.files.length > 0) {
             const buf = await picker.files[0].arrayBuffer();
-            tileRows = await unmarshal(buf);
+            const map = await unmarshal(buf);
+            tileRows = map.rows;
+            mapOverrides = map.overrides;
         }
     };
     picker.click();
 }
 
+// Overrides are a JSON object with optional "Shared" and "Match" objects, holding the shared params and match rules
+// that differ while the map is played. They are checked by the server when it loads the map.
+function editOverrides() {
+    const text = window.prompt('Map overrides, e.g. {"Shared": {"PlayerSpeed": 3}, "Match": {"FragLimit": 10}}', JSON.stringify(mapOverrides));
+    if (text === null) {
+        return;
+    }
+    if (text.trim() === "") {
+        mapOverrides = {};
+        return;
+    }
+    try {
+        const overrides = JSON.parse(text);
+        if (typeof overrides !== "object" || overrides === null || Array.isArray(overrides)) {
+            throw new Error("overrides must be an object");
+        }
+        for (const key of Object.keys(overrides)) {
+            if (key !== "Shared" && key !== "Match") {
+                throw new Error("unknown section: " + key);
+            }
+        }
+        mapOverrides = overrides;
+    } catch (err) {
+        window.alert("Bad overrides: " + err.message);
+    }
+}
+
 function saveFile() {
-    const file = marshal(tileRows);
+    const file = marshal(tileRows, mapOverrides);
     const link = document.createElement('a');
     link.href = URL.createObjectURL(file);
     link.download = file.name;
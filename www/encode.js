@@ -27,6 +27,15 @@ class Encoder {
         this._offset += 8;
     }
 
+    // Prefixed with length, must be no more than 255 bytes once encoded
+    writeString(val) {
+        const bytes = new TextEncoder().encode(val);
+        this.writeUint8(bytes.length);
+        for (const b of bytes) {
+            this.writeUint8(b);
+        }
+    }
+
     writeVec(val) {
         this._dv.setFloat64(this._offset, val.x);
         this._offset += 8;
@@ -67,6 +76,12 @@ class Decoder {
         return val;
     }
 
+    readInt16() {
+        let val = this._dv.getInt16(this._offset);
+        this._offset += 2;
+        return val;
+    }
+
     readInt32() {
         let val = this._dv.getInt32(this._offset);
         this._offset += 4;
@@ -87,6 +102,19 @@ class Decoder {
         return new Vec(x, y);
     }
 
+    readString() {
+        const length = this.readUint8();
+        const str = new TextDecoder().decode(this.uint8Array(length));
+        return str;
+    }
+
+    // Returns the unread part of the message
+    remainingBuffer() {
+        const buf = this._buf.slice(this._offset);
+        this._offset = this._buf.byteLength;
+        return buf;
+    }
+
     uint8Array(size) {
         let arr = new Uint8Array(this._buf, this._offset, size);
         this._offset += size;
@@ -1,12 +1,24 @@
 import * as conf from "./conf.js";
+import {Vec} from "./math.js";
+import {lerpVec} from "./interpolate.js";
 import * as player from "./player.js";
 import * as weapons from "./weapons.js";
 import * as net from "./net.js";
 import {Input} from "./input.js";
+import {Match, TEAM_NAMES} from "./match.js";
+import {Scoreboard} from "./scoreboard.js";
 
 const BACKGROUNDED_MS = 1000;
+const ANNOUNCEMENT_TICKS = 120;
+const SEEK_SECS = 10;
+const PLAYBACK_SPEEDS = [25, 50, 100, 200, 400]; // percent
 
 class Game {
+    static MODE_CTF = 0;
+    static MODE_KOTH = 1;
+    static MODE_TDM = 2;
+    static MODE_FFA = 3;
+
     doDebug = true;
     doSpeedup = false;
     doNetReset = false;
@@ -15,7 +27,11 @@ class Game {
     deltaMs;
     updateTimestampMs = performance.now();
     
+    modeId = Game.MODE_CTF;
     map = null;
+    mapName = "";
+    preset = ""; // name of the rules being played with
+    mapVote = []; // {name, count} for each candidate, empty if no vote running
     graphics;
     input;
 
@@ -23,12 +39,121 @@ class Game {
     otherPlayers = [];
     laserList = [];
     flagList = [];
+    flagTeams = [];
+    hills = [];
+    hillTarget = 0; // ticks of control needed to win
+    match = new Match();
+    scoreboard = new Scoreboard(this);
+    names = new Map(); // player id to display name
+    announcement = ""; // short lived message for events such as jailbreaks
+    announcementTicks = 0;
+    followId = -1; // player followed while spectating, -1 to roam freely
+    roamPos = new Vec(); // camera position while roaming
+    prevRoamPos = new Vec();
+    playback = null; // {frame, numFrames, paused, speed} when watching a captured match
 
     constructor(graphics, input) {
         this.graphics = graphics;
         this.input = input;
     }
 
+    announce(text) {
+        this.announcement = text;
+        this.announcementTicks = ANNOUNCEMENT_TICKS;
+    }
+
+    isSpectating() {
+        return this.player.state === player.Player.STATE_SPECTATING;
+    }
+
+    // Where the camera should be while spectating
+    spectatorViewPos(lerpFraction) {
+        const followed = this.otherPlayers.find(p => p.id === this.followId);
+        if (followed !== undefined) {
+            return lerpVec(followed.prevPos, followed.pos, lerpFraction);
+        }
+        return lerpVec(this.prevRoamPos, this.roamPos, lerpFraction);
+    }
+
+    _updateSpectator() {
+        // Cycle through players in play, then back to roaming
+        const playing = this.otherPlayers.filter(p => p.state !== player.Player.STATE_SPECTATING);
+        let followed = playing.find(p => p.id === this.followId);
+        if (this.input.wasActivated(Input.CMD_FOLLOW)) {
+            const next = followed === undefined ? 0 : playing.indexOf(followed) + 1;
+            followed = playing[next];
+        }
+        if (followed === undefined) {
+            this.followId = -1;
+        } else {
+            this.followId = followed.id;
+            this.roamPos.set(followed.pos); // roaming continues from the last followed player
+        }
+
+        this.prevRoamPos.set(this.roamPos);
+        if (this.followId !== -1) {
+            return;
+        }
+        const dir = new Vec();
+        if (this.input.isActive(Input.CMD_LEFT)) {
+            dir.x -= 1;
+        }
+        if (this.input.isActive(Input.CMD_RIGHT)) {
+            dir.x += 1;
+        }
+        if (this.input.isActive(Input.CMD_UP)) {
+            dir.y += 1;
+        }
+        if (this.input.isActive(Input.CMD_DOWN)) {
+            dir.y -= 1;
+        }
+        this.roamPos = this.roamPos.add(dir.scale(2 * conf.PLAYER_SPEED));
+    }
+
+    _updatePlayback() {
+        const playback = this.playback;
+        if (this.input.wasActivated(Input.CMD_PAUSE)) {
+            net.sendPlaybackCommand(net.PLAYBACK_PAUSE, playback.paused ? 0 : 1);
+        }
+
+        const seekStep = Math.round(SEEK_SECS * 1000 / conf.UPDATE_MS);
+        let seekTicks = 0;
+        if (this.input.wasActivated(Input.CMD_SEEK_BACK)) {
+            seekTicks -= seekStep;
+        }
+        if (this.input.wasActivated(Input.CMD_SEEK_FORWARD)) {
+            seekTicks += seekStep;
+        }
+        if (seekTicks !== 0) {
+            net.sendPlaybackCommand(net.PLAYBACK_SEEK, Math.max(0, playback.frame + seekTicks));
+        }
+
+        let speedIndex = PLAYBACK_SPEEDS.indexOf(Math.round(playback.speed * 100));
+        if (speedIndex === -1) {
+            speedIndex = PLAYBACK_SPEEDS.indexOf(100);
+        }
+        if (this.input.wasActivated(Input.CMD_SLOWER)) {
+            speedIndex = Math.max(0, speedIndex - 1);
+            net.sendPlaybackCommand(net.PLAYBACK_SPEED, PLAYBACK_SPEEDS[speedIndex]);
+        }
+        if (this.input.wasActivated(Input.CMD_FASTER)) {
+            speedIndex = Math.min(PLAYBACK_SPEEDS.length - 1, speedIndex + 1);
+            net.sendPlaybackCommand(net.PLAYBACK_SPEED, PLAYBACK_SPEEDS[speedIndex]);
+        }
+    }
+
+    isFreeForAll() {
+        return this.modeId === Game.MODE_FFA;
+    }
+
+    // Name of a team, or of a player in free-for-all
+    sideLabel(side) {
+        if (this.isFreeForAll()) {
+            return this.scoreboard.playerLabel(side);
+        }
+        return TEAM_NAMES[side];
+    }
+
     isBackgrounded() {
         if (performance.now() - this.updateTimestampMs > BACKGROUNDED_MS) {
             console.log("game backgrounded");
@@ -71,8 +196,29 @@ class Game {
             this.input.toggleRecord();
         }
 
+        for (let i = 0; i < this.mapVote.length; i++) {
+            if (this.input.wasActivated(Input.CMD_VOTE_1 + i)) {
+                net.sendVote(i);
+            }
+        }
+
+        if (this.announcementTicks > 0) {
+            this.announcementTicks--;
+        }
+
+        if (this.playback !== null) {
+            this._updatePlayback();
+        } else if (this.input.wasActivated(Input.CMD_SPECTATE)) {
+            net.sendSpectate(!this.isSpectating());
+        }
+        if (this.isSpectating()) {
+            this._updateSpectator();
+        }
+
         player.sampleInput(this);
-        net.sendInput(this);
+        if (this.playback === null) {
+            net.sendInput(this);
+        }
         // move projectiles before spawning new ones (gives an additional tick for lagg compensation)
         weapons.update(this);
         player.update(this);
@@ -2,6 +2,9 @@ import {lerpVec, extrapolateVec} from "../interpolate.js";
 import { Vec, Transform } from "../math.js";
 import {Tile} from "../map/map.js";
 import {Laser} from "../weapons.js";
+import {Input} from "../input.js";
+import {Match, formatTicks} from "../match.js";
+import {Player} from "../player.js";
 import * as conf from "../conf.js";
 import { Renderer } from "./renderer.js";
 import { Color } from "./color.js";
@@ -128,15 +131,22 @@ class Graphics {
         const lerpFraction = game.accumMs/conf.UPDATE_MS;
         const lerpPos = lerpVec(game.player.prevPos, game.player.pos, lerpFraction);
 
-        this.camera.update(lerpPos.x, lerpPos.y, this.screenSize.x, this.screenSize.y);
+        const viewPos = game.isSpectating() ? game.spectatorViewPos(lerpFraction) : lerpPos;
+        this.camera.update(viewPos.x, viewPos.y, this.screenSize.x, this.screenSize.y);
 
         let shipRadius = conf.PLAYER_RADIUS / assets.shipPixelRatio;
 
-        let shipPositions = [lerpPos]
+        // Spectators are not drawn
+        const shipPlayers = []; // [player, pos]
+        if (!game.isSpectating()) {
+            shipPlayers.push([game.player, lerpPos]);
+        }
         for (let other of game.otherPlayers) {
-            const lerpPos = lerpVec(other.prevPos, other.pos, lerpFraction);
-            shipPositions.push(lerpPos);
+            if (other.state !== Player.STATE_SPECTATING) {
+                shipPlayers.push([other, lerpVec(other.prevPos, other.pos, lerpFraction)]);
+            }
         }
+        const shipPositions = shipPlayers.map(([player, pos]) => pos);
 
         // ========== DRAW NORMALS ==========
         gl.clearColor(0.0, 0.0, 0.0, 0.0); // < 1 in alpha channel for normals means no lighting
@@ -341,6 +351,39 @@ class Graphics {
             }
         }
 
+        // Draw hills, coloured by the team that controls them
+        const teamColors = [[0, 1, 0], [1, 0, 0], [0, 0, 1], [1, 1, 0]];
+        for (const hill of game.hills) {
+            if (hill.contested) {
+                this.renderer.setColor(1, 1, 1);
+            } else if (hill.owner === -1) {
+                this.renderer.setColor(0.5, 0.5, 0.5);
+            } else {
+                this.renderer.setColor(...teamColors[hill.owner]);
+            }
+            this.renderer.drawCircleLine(hill.pos.x, hill.pos.y, conf.TILE_SIZE);
+        }
+
+        // Draw jail release tiles in the colour of the team they free, they have no texture
+        const inset = 4;
+        for (const release of game.map.jailReleases) {
+            this.renderer.setColor(...teamColors[release.team]);
+            this.renderer.drawRectLine(release.pos.x + inset, release.pos.y + inset, conf.TILE_SIZE - 2*inset, conf.TILE_SIZE - 2*inset, 2);
+        }
+
+        // Draw names under tanks
+        {
+            const height = 14;
+            for (const [player, pos] of shipPlayers) {
+                const name = game.names.get(player.id);
+                if (name === undefined) {
+                    continue;
+                }
+                const width = assets.arialFont.calcBounds(name, height).x;
+                this.renderer.drawText(name, pos.x - width/2, pos.y - conf.PLAYER_RADIUS - height, assets.arialFont, height);
+            }
+        }
+
 
         this.renderer.render(this.camera);
 
@@ -376,6 +419,72 @@ class Graphics {
             }
         }
 
+        // Draw match status
+        {
+            const height = 20;
+            const text = game.match.statusText(side => game.sideLabel(side));
+            const width = assets.arialFont.calcBounds(text, height).x;
+            this.renderer.drawText(text, this.screenSize.x/2 - width/2, this.screenSize.y - border - height, assets.arialFont, height);
+        }
+
+        // Draw announcement
+        if (game.announcementTicks > 0) {
+            const height = 24;
+            const width = assets.arialFont.calcBounds(game.announcement, height).x;
+            this.renderer.drawText(game.announcement, this.screenSize.x/2 - width/2, this.screenSize.y/2 + 100, assets.arialFont, height);
+        }
+
+        // Draw spectator controls
+        if (game.isSpectating()) {
+            const height = 16;
+            let text = "SPECTATING";
+            if (game.followId !== -1) {
+                text += " " + game.scoreboard.playerLabel(game.followId);
+            }
+            if (game.playback === null) {
+                text += "  (F: FOLLOW NEXT, O: JOIN GAME)";
+            } else {
+                text += "  (F: FOLLOW NEXT)";
+            }
+            const width = assets.arialFont.calcBounds(text, height).x;
+            this.renderer.drawText(text, this.screenSize.x/2 - width/2, border * 3, assets.arialFont, height);
+        }
+
+        // Draw playback controls
+        if (game.playback !== null) {
+            const height = 16;
+            const playback = game.playback;
+            let text = "REPLAY " + formatTicks(playback.frame) + " / " + formatTicks(playback.numFrames);
+            text += "  x" + playback.speed;
+            if (playback.paused) {
+                text += "  PAUSED";
+            }
+            text += "  (SPACE: PAUSE, ,/.: SEEK, [/]: SPEED)";
+            const width = assets.arialFont.calcBounds(text, height).x;
+            this.renderer.drawText(text, this.screenSize.x/2 - width/2, border * 4 + height, assets.arialFont, height);
+        }
+
+        // Draw map vote
+        {
+            const height = 20;
+            for (let i = 0; i < game.mapVote.length; i++) {
+                const candidate = game.mapVote[i];
+                const text = (i+1) + ": " + candidate.name + " (" + candidate.count + ")";
+                const width = assets.arialFont.calcBounds(text, height).x;
+                this.renderer.drawText(text, this.screenSize.x/2 - width/2, this.screenSize.y - (i + 2) * (border + height), assets.arialFont, height);
+            }
+        }
+
+        // Draw scoreboard while held or between rounds
+        if (game.input.isActive(Input.CMD_SCOREBOARD) || game.match.phase === Match.PHASE_INTERMISSION || game.match.phase === Match.PHASE_OVER) {
+            const height = 18;
+            const rows = game.scoreboard.textRows(game.match);
+            const top = this.screenSize.y * 0.75;
+            for (let i = 0; i < rows.length; i++) {
+                this.renderer.drawText(rows[i], this.screenSize.x/4, top - i * (border + height), assets.arialFont, height);
+            }
+        }
+
         // Draw diagnostics (fps, latency, etc)
         {
             const height = 20;
@@ -22,7 +22,18 @@ class Input {
     static CMD_DROP_FLAG = 6;
     static CMD_TOGGLE_DEBUG = 7;
     static CMD_TOGGLE_RECORD = 8;
-    static CMD_LAST = 9; // MUST BE LAST
+    static CMD_VOTE_1 = 9; // vote commands must be consecutive, one per conf.MaxMapVoteCandidates
+    static CMD_VOTE_2 = 10;
+    static CMD_VOTE_3 = 11;
+    static CMD_SCOREBOARD = 12;
+    static CMD_SPECTATE = 13;
+    static CMD_FOLLOW = 14;
+    static CMD_PAUSE = 15;
+    static CMD_SEEK_BACK = 16;
+    static CMD_SEEK_FORWARD = 17;
+    static CMD_SLOWER = 18;
+    static CMD_FASTER = 19;
+    static CMD_LAST = 20; // MUST BE LAST
 
     _commands = [];
     _keyMap = {};
@@ -44,6 +55,17 @@ class Input {
         this._keyMap['g'] = Input.CMD_DROP_FLAG;
         this._keyMap['p'] = Input.CMD_TOGGLE_DEBUG;
         this._keyMap['r'] = Input.CMD_TOGGLE_RECORD;
+        this._keyMap['1'] = Input.CMD_VOTE_1;
+        this._keyMap['2'] = Input.CMD_VOTE_2;
+        this._keyMap['3'] = Input.CMD_VOTE_3;
+        this._keyMap['tab'] = Input.CMD_SCOREBOARD;
+        this._keyMap['o'] = Input.CMD_SPECTATE;
+        this._keyMap['f'] = Input.CMD_FOLLOW;
+        this._keyMap[' '] = Input.CMD_PAUSE;
+        this._keyMap[','] = Input.CMD_SEEK_BACK;
+        this._keyMap['.'] = Input.CMD_SEEK_FORWARD;
+        this._keyMap['['] = Input.CMD_SLOWER;
+        this._keyMap[']'] = Input.CMD_FASTER;
 
 
         for (let i = 0; i < Input.CMD_LAST; i++) {
@@ -81,11 +103,15 @@ class Input {
     }
 
     _onKeyDown(event) {
+        let key = event.key.toLowerCase();
+        if (key === 'tab') {
+            event.preventDefault(); // don't move focus off the canvas
+        }
+
         if (event.repeat) {
             return
         }
 
-        let key = event.key.toLowerCase();
         if (this._doRecord && this._keyMap[key] !== Input.CMD_TOGGLE_RECORD) {
             this._recordedEvents.push(event);
             this._didRecordEvent = true;
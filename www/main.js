@@ -34,9 +34,7 @@ window.onload = async function() {
     const graphics = new Graphics(canvas);
     const input = new Input(graphics);
 
-    const testMap = await map.fromFile("assets/maps/test.bin");
-    const game = new Game(graphics, input);
-    game.map = testMap;
+    const game = new Game(graphics, input); // map is sent by the server once connected
 
     await net.connect(game);
 
@@ -31,6 +31,13 @@ class TileType {
 
     static FLAG_SPAWN;
 
+    static CAPTURE_ZONE;
+
+    static GREEN_JAIL_RELEASE;
+    static RED_JAIL_RELEASE;
+    static BLUE_JAIL_RELEASE;
+    static YELLOW_JAIL_RELEASE;
+
     static nextId = 0;
     static typeList = [];
 
@@ -137,6 +144,15 @@ function defineTileTypes() {
     TileType.FLAG_SPAWN = new TileType();
     TileType.FLAG_SPAWN.albedoTextures = _mapTextures("flag_spawn");
     TileType.FLAG_SPAWN.normalTextures = _mapTextures("flag_goal_normal");
+
+    TileType.CAPTURE_ZONE = new TileType();
+    //TileType.CAPTURE_ZONE.albedoTextures = _mapTextures("capture_zone");
+    //TileType.CAPTURE_ZONE.normalTextures = _mapTextures("flag_goal_normal");
+
+    TileType.GREEN_JAIL_RELEASE = new TileType();
+    TileType.RED_JAIL_RELEASE = new TileType();
+    TileType.BLUE_JAIL_RELEASE = new TileType();
+    TileType.YELLOW_JAIL_RELEASE = new TileType();
 }
 
 function _mapTextures(name, orientations=1, variations=1) {
@@ -257,9 +273,11 @@ function posFromRowCol(row, col) {
 class Map {
     tileRows;
     numFlags = 0;
+    jailReleases = []; // {pos, team} of each jail release tile
 
     constructor(rows) {
         this.tileRows = rows;
+        const releaseTypes = [TileType.GREEN_JAIL_RELEASE, TileType.RED_JAIL_RELEASE, TileType.BLUE_JAIL_RELEASE, TileType.YELLOW_JAIL_RELEASE]; // team order
         for (let r = 0; r < rows.length; r++) {
             for (let c = 0; c < rows[r].length; c++) {
                 const tile = this.tileRows[r][c];
@@ -268,6 +286,10 @@ class Map {
                         this.numFlags++;
                         break;
                 }
+                const team = releaseTypes.indexOf(tile.type);
+                if (team !== -1) {
+                    this.jailReleases.push({pos: tile.pos, team: team});
+                }
             }
         }
     }
@@ -294,10 +316,9 @@ class Map {
     }
 }
 
-async function fromFile() {
-    const buf = (await assets.request("assets/maps/test.bin", "arraybuffer")).response;
-    const rows = await unmarshal(buf);
+async function fromBuffer(buf) {
+    const {rows} = await unmarshal(buf); // overrides are applied by the server, which sends us the resulting params
     return new Map(rows);
 }
 
-export{Tile, TileType, Map, defineTileTypes, posFromRowCol, fromFile};
\ No newline at end of file
+export{Tile, TileType, Map, defineTileTypes, posFromRowCol, fromBuffer};
\ No newline at end of file
@@ -1,10 +1,14 @@
 import { Tile, TileType } from "./map.js";
 
+// Map files may start with this and a length prefixed JSON header of gameplay overrides, e.g. {"Shared": {"PlayerSpeed": 3}}
+const MAP_MAGIC = "CTFMAP";
+
 function logBits(dec) {
     console.log((dec >>> 0).toString(2));
 }
 
-function marshal(rows) {
+// Overrides are left out of the file if empty
+function marshal(rows, overrides = {}) {
     rows = trimRows(rows);
     console.log(rows.length, rows[0].length)
 
@@ -12,6 +16,17 @@ function marshal(rows) {
     const view = new DataView(arrBuf);
     let byteOffset = 0;
 
+    if (Object.keys(overrides).length > 0) {
+        const encoder = new TextEncoder();
+        const header = encoder.encode(JSON.stringify(overrides));
+        new Uint8Array(arrBuf, byteOffset).set(encoder.encode(MAP_MAGIC));
+        byteOffset += MAP_MAGIC.length;
+        view.setUint16(byteOffset, header.length);
+        byteOffset += 2;
+        new Uint8Array(arrBuf, byteOffset).set(header);
+        byteOffset += header.length;
+    }
+
     view.setUint16(byteOffset, rows[0].length);
     byteOffset += 2;
     
@@ -51,9 +66,21 @@ function marshal(rows) {
     return new File([new DataView(arrBuf, 0, byteOffset)], "map.bin");
 }
 
+// Returns the rows of tiles and the map's overrides, which are empty if the map has none
 async function unmarshal(arrayBuffer) {
     const view =  new DataView(arrayBuffer);
     let byteOffset = 0;
+
+    let overrides = {};
+    const decoder = new TextDecoder();
+    if (arrayBuffer.byteLength >= MAP_MAGIC.length && decoder.decode(new Uint8Array(arrayBuffer, 0, MAP_MAGIC.length)) === MAP_MAGIC) {
+        byteOffset += MAP_MAGIC.length;
+        const headerLength = view.getUint16(byteOffset);
+        byteOffset += 2;
+        overrides = JSON.parse(decoder.decode(new Uint8Array(arrayBuffer, byteOffset, headerLength)));
+        byteOffset += headerLength;
+    }
+
     const rowSize = view.getUint16(byteOffset);
     byteOffset += 2;
 
@@ -83,7 +110,7 @@ async function unmarshal(arrayBuffer) {
         }
     }
 
-    return rowList;
+    return {rows: rowList, overrides: overrides};
 }
 
 function trimRows(rows) {
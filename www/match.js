@@ -0,0 +1,66 @@
+import * as conf from "./conf.js";
+
+const NUM_TEAMS = 4;
+const TEAM_NAMES = ["GREEN", "RED", "BLUE", "YELLOW"];
+
+// Duration in ticks as minutes and seconds, e.g. 2:05
+function formatTicks(ticks) {
+    const secs = Math.ceil(ticks * conf.UPDATE_MS / 1000);
+    const mins = Math.floor(secs / 60);
+    return mins + ":" + String(secs % 60).padStart(2, "0");
+}
+
+class Match {
+    static PHASE_WAITING = 0;
+    static PHASE_WARMUP = 1;
+    static PHASE_LIVE = 2;
+    static PHASE_OVERTIME = 3;
+    static PHASE_INTERMISSION = 4;
+    static PHASE_OVER = 5;
+
+    phase = Match.PHASE_WAITING;
+    phaseTicks = 0; // ticks remaining in phase, 0 if untimed
+    round = 0;
+    roundWins = new Array(NUM_TEAMS).fill(0);
+    scores = new Array(NUM_TEAMS).fill(0); // score in current round, meaning depends on game mode
+    roundWinner = -1;
+    matchWinner = -1;
+
+    // Short description of the current phase for the HUD, sideLabel names the winning team or player
+    statusText(sideLabel) {
+        let text;
+        switch (this.phase) {
+            case Match.PHASE_WAITING:
+                return "WAITING FOR PLAYERS";
+            case Match.PHASE_WARMUP:
+                text = "WARMUP";
+                break;
+            case Match.PHASE_LIVE:
+                text = "ROUND " + this.round;
+                break;
+            case Match.PHASE_OVERTIME:
+                text = "OVERTIME";
+                break;
+            case Match.PHASE_INTERMISSION:
+                if (this.roundWinner === -1) {
+                    text = "ROUND DRAWN";
+                } else {
+                    text = sideLabel(this.roundWinner) + " WINS ROUND";
+                }
+                break;
+            case Match.PHASE_OVER:
+                text = sideLabel(this.matchWinner) + " WINS MATCH";
+                break;
+        }
+        if (this.phaseTicks > 0) {
+            text += " " + this._formatTime();
+        }
+        return text;
+    }
+
+    _formatTime() {
+        return formatTicks(this.phaseTicks);
+    }
+}
+
+export { Match, TEAM_NAMES, formatTicks };
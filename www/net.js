@@ -1,23 +1,53 @@
 import { Encoder, Decoder } from "./encode.js";
 import { Player} from "./player.js";
 import { Laser } from "./weapons.js";
-import { Map } from "./map/map.js";
+import * as map from "./map/map.js";
 import * as sound from "./sound.js";
 import * as particle from "./gfx/particle.js";
+import { TEAM_NAMES } from "./match.js";
+import * as conf from "./conf.js";
 
 let socket;
 
+const RECONNECT_POLL_MS = 1000;
+const RECONNECT_TIMEOUT_MS = 60000; // server keeps our player this long after restarting
+
 async function connect(game) {
-    socket = new WebSocket('ws://' + window.location.host + '/ws');
+    // Room code is passed through from the page url, e.g. /?room=abc
+    const params = new URLSearchParams(window.location.search);
+    let query = '';
+    if (params.has('room')) {
+        query = '?room=' + encodeURIComponent(params.get('room'));
+        if (params.has('mode')) {
+            query += '&mode=' + encodeURIComponent(params.get('mode')); // used if room needs to be opened
+        }
+        if (params.has('preset')) {
+            query += '&preset=' + encodeURIComponent(params.get('preset')); // rules to play with if room is opened
+        }
+    }
+    if (params.get('spectate') === '1') {
+        query += (query === '' ? '?' : '&') + 'spectate=1';
+    }
+    // Lets us back into our player if the server has restarted
+    const token = sessionStorage.getItem("token");
+    if (token !== null) {
+        query += (query === '' ? '?' : '&') + 'token=' + encodeURIComponent(token);
+    }
+    socket = new WebSocket('ws://' + window.location.host + '/ws' + query);
     socket.binaryType = 'arraybuffer';
+    let opened = false;
     let connectPromise = new Promise(function(resolve, reject) {
         socket.addEventListener('open', function (event) {
+            opened = true;
             resolve();
         });
 
         socket.addEventListener('close', function (event) {
             reject();
             console.log("Websocket closed");
+            if (opened && sessionStorage.getItem("token") !== null) {
+                _reloadWhenServerUp(performance.now());
+            }
         });
     });
 
@@ -31,6 +61,22 @@ async function connect(game) {
 const inputMsgType = 0;
 const stateUpdateMsgType = 1;
 const initMsgType = 2;
+const mapMsgType = 3;
+const mapVoteMsgType = 4;
+const castVoteMsgType = 5;
+const scoreboardMsgType = 6;
+const nameMsgType = 7;
+const nameRejectedMsgType = 8;
+const rosterMsgType = 9;
+const spectateMsgType = 10;
+const playbackMsgType = 11;
+const playbackCtrlMsgType = 12;
+const paramsMsgType = 13;
+
+// Commands for controlling playback of a captured match
+const PLAYBACK_PAUSE = 0; // value is 1 to pause, 0 to resume
+const PLAYBACK_SEEK = 1; // value is the frame to jump to
+const PLAYBACK_SPEED = 2; // value is the speed in percent
 
 const leftBit = 1;
 const rightBit = 2;
@@ -83,6 +129,29 @@ function sendInput(game) {
 	socket.send(encoder.getView());
 }
 
+function sendVote(candidate) {
+    encoder.reset();
+    encoder.writeUint8(castVoteMsgType);
+    encoder.writeUint8(candidate);
+    socket.send(encoder.getView());
+}
+
+// Switch between spectating and playing
+function sendSpectate(spectate) {
+    encoder.reset();
+    encoder.writeUint8(spectateMsgType);
+    encoder.writeUint8(spectate ? 1 : 0);
+    socket.send(encoder.getView());
+}
+
+function sendPlaybackCommand(cmd, value) {
+    encoder.reset();
+    encoder.writeUint8(playbackCtrlMsgType);
+    encoder.writeUint8(cmd);
+    encoder.writeInt32(value);
+    socket.send(encoder.getView());
+}
+
 function consumeMessage(msg, game) {
     // If app is backgrounded by browser it will stop receiving animation callbacks, but it will still receive
     // network callbacks. We can ignore game state update messages from the server and reset the client net state
@@ -102,11 +171,118 @@ function consumeMessage(msg, game) {
         case initMsgType:
             _processInitMsg(game, decoder);
             break
+        case mapMsgType:
+            _processMapMsg(game, decoder);
+            break;
+        case mapVoteMsgType:
+            _processMapVoteMsg(game, decoder);
+            break;
+        case scoreboardMsgType:
+            _processScoreboardMsg(game, decoder);
+            break;
+        case nameRejectedMsgType:
+            _chooseName(decoder.readString());
+            break;
+        case rosterMsgType:
+            _processRosterMsg(game, decoder);
+            break;
+        case playbackMsgType:
+            _processPlaybackMsg(game, decoder);
+            break;
+        case paramsMsgType:
+            _processParamsMsg(game, decoder);
+            break;
+    }
+}
+
+async function _processMapMsg(game, decoder) {
+    const name = decoder.readString();
+    console.log("loading map: ", name);
+    game.mapName = name;
+    game.laserList = [];
+    game.map = await map.fromBuffer(decoder.remainingBuffer());
+}
+
+// The server's shared params, which may differ from shared.json if the room has a rule preset or has been tuned
+function _processParamsMsg(game, decoder) {
+    const preset = decoder.readString();
+    if (game.preset !== "" && preset !== game.preset) {
+        game.announce("RULES: " + preset.toUpperCase());
+    }
+    game.preset = preset;
+    const text = new TextDecoder().decode(decoder.remainingBuffer());
+    conf.applyConf(JSON.parse(text));
+}
+
+function _processMapVoteMsg(game, decoder) {
+    const numCandidates = decoder.readUint8();
+    game.mapVote = [];
+    for (let i = 0; i < numCandidates; i++) {
+        const name = decoder.readString();
+        const count = decoder.readUint8();
+        game.mapVote.push({name: name, count: count});
     }
 }
 
 function _processInitMsg(game, decoder) {
     game.player.id = decoder.readUint8();
+    sessionStorage.setItem("token", decoder.readString());
+    const needsName = decoder.readUint8() === 1; // false if we reconnected into our old player
+    if (needsName) {
+        _chooseName("");
+    }
+}
+
+// Reloads the page once the server is back up, e.g. after a restart
+async function _reloadWhenServerUp(startMs) {
+    try {
+        await fetch('shared.json', {cache: 'no-store'});
+        window.location.reload();
+        return;
+    } catch (error) {
+        // server still down
+    }
+    if (performance.now() - startMs < RECONNECT_TIMEOUT_MS) {
+        setTimeout(() => _reloadWhenServerUp(startMs), RECONNECT_POLL_MS);
+    }
+}
+
+// Asks the user for a display name and sends it to the server (which may reject it)
+function _chooseName(rejectReason) {
+    let message = "Choose a name";
+    if (rejectReason !== "") {
+        message = rejectReason + ". " + message;
+    }
+    let name = window.prompt(message, localStorage.getItem("name") || "");
+    if (name === null) {
+        name = "";
+    }
+    name = name.trim();
+    localStorage.setItem("name", name);
+
+    encoder.reset();
+    encoder.writeUint8(nameMsgType);
+    encoder.writeString(name);
+    socket.send(encoder.getView());
+}
+
+// Only sent when watching a captured match
+function _processPlaybackMsg(game, decoder) {
+    game.playback = {
+        frame: decoder.readInt32(),
+        numFrames: decoder.readInt32(),
+        paused: decoder.readUint8() === 1,
+        speed: decoder.readFloat64(),
+    };
+}
+
+function _processRosterMsg(game, decoder) {
+    game.names.clear();
+    const numPlayers = decoder.readUint8();
+    for (let i = 0; i < numPlayers; i++) {
+        const id = decoder.readUint8();
+        game.names.set(id, decoder.readString());
+    }
 }
 
 function _processUpdateMsg(game, decoder) {
@@ -124,11 +300,15 @@ function _processUpdateMsg(game, decoder) {
         ackedTick = decoder.readUint8();
     }
 
+    game.modeId = decoder.readUint8();
+    _decodeMatch(game.match, decoder);
+
     let newState = decoder.readUint8();
     if (game.player.state !== newState) {
         game.player.stateChanged = true;
     }
     game.player.state = newState;
+    game.player.team = decoder.readInt8(); // -1 in free-for-all
 
     game.player.flagIndex = decoder.readInt8();
 
@@ -170,6 +350,7 @@ function _processUpdateMsg(game, decoder) {
             otherPlayer.stateChanged = true;
         }
         otherPlayer.state = newState;
+        otherPlayer.team = decoder.readInt8();
         otherPlayer.acked.pos = decoder.readVec();
         otherPlayer.lastAckedDirNum = decoder.readUint8();
         otherPlayer.predictedDirs.ack(game.serverTick);
@@ -216,13 +397,74 @@ function _processUpdateMsg(game, decoder) {
         sound.playHit();
     }
 
+    let numJailbreaks = decoder.readUint8();
+    for (let i = 0; i < numJailbreaks; i++) {
+        const team = decoder.readInt8();
+        const jailPos = decoder.readVec();
+        game.graphics.particleSystem.addEmitter(new particle.Emitter(jailPos, particle.sparkEmitterParams));
+        game.announce(TEAM_NAMES[team] + " JAILBREAK!");
+    }
+
     let numFlags = decoder.readUint8();
     if (game.flagList.length !== numFlags) {
         game.flagList = new Array(numFlags);
+        game.flagTeams = new Array(numFlags);
     }
     for (let i = 0; i < numFlags; i++) {
         game.flagList[i] = decoder.readVec();
+        game.flagTeams[i] = decoder.readInt8(); // -1 if not delivered to a goal
+    }
+
+    game.hillTarget = decoder.readUint16();
+    const numHills = decoder.readUint8();
+    game.hills = [];
+    for (let i = 0; i < numHills; i++) {
+        const hill = {
+            pos: decoder.readVec(),
+            owner: decoder.readInt8(), // -1 if never controlled
+            contested: decoder.readUint8() === 1,
+            control: [],
+        };
+        for (let team = 0; team < game.match.roundWins.length; team++) {
+            hill.control.push(decoder.readUint16());
+        }
+        game.hills.push(hill);
+    }
+}
+
+function _processScoreboardMsg(game, decoder) {
+    const scoreboard = game.scoreboard;
+    for (let team = 0; team < scoreboard.teams.length; team++) {
+        scoreboard.teams[team].kills = decoder.readUint16();
+        scoreboard.teams[team].captures = decoder.readUint16();
+    }
+
+    scoreboard.players = [];
+    const numPlayers = decoder.readUint8();
+    for (let i = 0; i < numPlayers; i++) {
+        scoreboard.players.push({
+            id: decoder.readUint8(),
+            team: decoder.readInt8(),
+            kills: decoder.readUint16(),
+            deaths: decoder.readUint16(),
+            assists: decoder.readUint16(),
+            captures: decoder.readUint16(),
+            returns: decoder.readUint16(),
+            roundWins: decoder.readUint8(), // only used in free-for-all
+        });
+    }
+}
+
+function _decodeMatch(match, decoder) {
+    match.phase = decoder.readUint8();
+    match.phaseTicks = decoder.readInt32();
+    match.round = decoder.readUint8();
+    for (let team = 0; team < match.roundWins.length; team++) {
+        match.roundWins[team] = decoder.readUint8();
+        match.scores[team] = decoder.readUint16();
     }
+    match.roundWinner = decoder.readInt16(); // player id in free-for-all
+    match.matchWinner = decoder.readInt16();
 }
 
-export {connect, sendInput, socket};
\ No newline at end of file
+export {connect, sendInput, sendVote, sendSpectate, sendPlaybackCommand, PLAYBACK_PAUSE, PLAYBACK_SEEK, PLAYBACK_SPEED, socket};
\ No newline at end of file
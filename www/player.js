@@ -31,11 +31,17 @@ class Player {
     static STATE_JAILED = 1;
     static STATE_ALIVE = 2;
 
+    static TEAM_GREEN = 0;
+    static TEAM_RED = 1;
+    static TEAM_BLUE = 2;
+    static TEAM_YELLOW = 3;
+
     static MAX_INPUT_PREDICTIONS = 6000;
     static MAX_DIR_PREDICTIONS = 5;
 
     id;
     state = Player.STATE_SPECTATING;
+    team = Player.TEAM_GREEN;
     flagIndex = -1;
     stateChanged = false;
     inputState = null;
@@ -85,7 +91,7 @@ function sampleInput(game) {
 
     let shootCmd = game.input.getCommand(Input.CMD_SHOOT);
     if (shootCmd.wasActivated) {
-        if (game.player.predicted.energy >= conf.LASER_ENERGY_COST) {
+        if (conf.LASER_ENABLED && game.player.predicted.energy >= conf.LASER_ENERGY_COST) {
             inputState.doShoot = true;
             let aimPos = game.graphics.camera.unproject(shootCmd.mousePos);
             inputState.aimAngle = _calcAimAngle(game.player.pos, aimPos);
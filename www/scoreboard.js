@@ -0,0 +1,50 @@
+import { TEAM_NAMES } from "./match.js";
+
+class Scoreboard {
+    teams = TEAM_NAMES.map(() => ({kills: 0, captures: 0}));
+    players = []; // {id, team, kills, deaths, assists, captures, returns, roundWins}
+    game;
+
+    constructor(game) {
+        this.game = game;
+    }
+
+    // Rows of text for display, players are grouped by team and sorted by kills
+    textRows(match) {
+        const rows = this.game.isFreeForAll() ? this._freeForAllRows() : this._teamRows(match);
+        if (this.game.preset !== "" && this.game.preset !== "default") {
+            rows.unshift("RULES: " + this.game.preset.toUpperCase());
+        }
+        return rows;
+    }
+
+    _teamRows(match) {
+        const rows = [];
+        for (let team = 0; team < this.teams.length; team++) {
+            const teamPlayers = this.players.filter(p => p.team === team);
+            if (teamPlayers.length === 0) {
+                continue;
+            }
+            const teamStats = this.teams[team];
+            rows.push(TEAM_NAMES[team] + "  ROUNDS: " + match.roundWins[team] + "  SCORE: " + match.scores[team] + "  CAPTURES: " + teamStats.captures + "  KILLS: " + teamStats.kills);
+            teamPlayers.sort((a, b) => b.kills - a.kills);
+            for (const p of teamPlayers) {
+                rows.push("    " + this.playerLabel(p.id) + "  K " + p.kills + "  D " + p.deaths + "  A " + p.assists + "  C " + p.captures + "  R " + p.returns);
+            }
+        }
+        return rows;
+    }
+
+    // Individuals ranked by round wins then kills
+    _freeForAllRows() {
+        const ranked = [...this.players];
+        ranked.sort((a, b) => b.roundWins - a.roundWins || b.kills - a.kills);
+        return ranked.map((p, i) => (i+1) + ". " + this.playerLabel(p.id) + "  ROUNDS " + p.roundWins + "  K " + p.kills + "  D " + p.deaths + "  A " + p.assists);
+    }
+
+    playerLabel(id) {
+        return this.game.names.get(id) || "PLAYER " + id;
+    }
+}
+
+export { Scoreboard };